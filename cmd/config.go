@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd(configFile *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with the config file",
+	}
+	var strict bool
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Load the config and report every problem",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			cfg, err := app.LoadConfig(*configFile)
+			var warnings []string
+			if err == nil {
+				warnings, err = cfg.Validate(strict || cfg.StrictConfig)
+			}
+			var cfgErr *app.ConfigError
+			if errors.As(err, &cfgErr) {
+				for _, warning := range cfgErr.Warnings {
+					fmt.Fprintf(out, "warning: %s\n", warning)
+				}
+				for _, problem := range cfgErr.Problems {
+					fmt.Fprintf(out, "error: %s\n", problem)
+				}
+				return fmt.Errorf("%s has %d problem(s)", *configFile, len(cfgErr.Problems))
+			}
+			if err != nil {
+				return err
+			}
+			for _, warning := range warnings {
+				fmt.Fprintf(out, "warning: %s\n", warning)
+			}
+			fmt.Fprintf(out, "%s is valid\n", *configFile)
+			return nil
+		},
+	}
+	validate.Flags().BoolVar(&strict, "strict", false, "treat warnings as errors, as strict_config does")
+	cmd.AddCommand(validate)
+	return cmd
+}
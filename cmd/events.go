@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/fifa"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+	"github.com/spf13/cobra"
+)
+
+// newFIFAClient returns the client used to reach FIFA. Tests point it at a
+// fake FIFA.
+var newFIFAClient = func() *go_fifa.Client {
+	return &go_fifa.Client{}
+}
+
+func newEventsCmd(configFile *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Inspect match timelines",
+	}
+	var competitionID, seasonID, stageID string
+	dump := &cobra.Command{
+		Use:   "dump <match-id>",
+		Short: "Print a match's timeline as the bot would render it",
+		Long: `Print every event on a match's FIFA timeline with the message the bot
+would send for it, using the configured skip_events and custom_events.
+Nothing is sent or stored. The competition, season and stage are read
+from storage unless they are given as flags.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			match := models.Match{
+				CompetitionId: competitionID,
+				SeasonId:      seasonID,
+				StageId:       stageID,
+				MatchId:       args[0],
+			}
+			if competitionID == "" || seasonID == "" || stageID == "" {
+				db, closeDB, err := openCommandDatabase(cmd, cfg)
+				if err != nil {
+					return err
+				}
+				defer closeDB()
+				match, err = db.GetMatch(cmd.Context(), args[0])
+				if err != nil {
+					return fmt.Errorf("failed to get match %s, pass --competition, --season and --stage for a match that is not stored. %w", args[0], err)
+				}
+			}
+			customEvents := app.CustomEventsFromConfig(cfg)
+			skipSet, err := fifa.ParseEventNamesWith(cfg.SkipEvents, customEvents)
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", err)
+			}
+			// Render from the start of the match, as the shootout tally is
+			// built up event by event
+			match.HomeTeamPenaltyResults = ""
+			match.AwayTeamPenaltyResults = ""
+			data, err := fifa.GetMatchEvents(cmd.Context(), newFIFAClient(), &match)
+			if err != nil {
+				return fmt.Errorf("failed to get match %s events from FIFA. %w", match.MatchId, err)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "EVENT\tMINUTE\tTYPE\tMESSAGE")
+			for _, evt := range data.NewEvents {
+				result := customEvents.ProcessEvent(cmd.Context(), evt, &match, skipSet)
+				text := result.SlackMessage
+				switch {
+				case result.IsUnknown:
+					text = fmt.Sprintf("(unknown event type %d)", evt.Type)
+				case text == "":
+					text = "(skipped)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", evt.Id, evt.MatchMinute, customEvents.Name(evt.Type), text)
+			}
+			if data.PendingEventFound {
+				fmt.Fprintln(w, "\t\tPending\t(the timeline stops at an event FIFA has not finished)")
+			}
+			return w.Flush()
+		},
+	}
+	dump.Flags().StringVar(&competitionID, "competition", "", "competition ID, when the match is not stored")
+	dump.Flags().StringVar(&seasonID, "season", "", "season ID, when the match is not stored")
+	dump.Flags().StringVar(&stageID, "stage", "", "stage ID, when the match is not stored")
+	cmd.AddCommand(dump, newUnknownEventsCmd(configFile))
+	return cmd
+}
+
+func newUnknownEventsCmd(configFile *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unknown [type]",
+		Short: "List quarantined events of types the bot does not know",
+		Long: `Without a type, list the quarantined unknown events grouped by type code,
+with the custom_events name a type is mapped to. With a type, print each
+quarantined event of that type as the JSON received from FIFA, one per
+line, to work out what the type means before mapping it.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			eventType := 0
+			if len(args) == 1 {
+				var err error
+				if eventType, err = strconv.Atoi(args[0]); err != nil {
+					return fmt.Errorf("event type must be a number, got %q", args[0])
+				}
+			}
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			q, closeDB, err := openQuarantine(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			events, err := q.GetUnknownEvents(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to get unknown events. %w", err)
+			}
+			if len(args) == 1 {
+				for _, e := range events {
+					if e.Type == eventType {
+						fmt.Fprintln(cmd.OutOrStdout(), string(e.Payload))
+					}
+				}
+				return nil
+			}
+			customEvents := app.CustomEventsFromConfig(cfg)
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TYPE\tCOUNT\tMATCHES\tFIRST SEEN\tLAST SEEN\tMAPPED TO")
+			for _, t := range models.GroupUnknownEvents(events) {
+				mapped := "-"
+				if c, ok := customEvents[go_fifa.MatchEvent(t.Type)]; ok {
+					mapped = c.Name
+				}
+				fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\t%s\n", t.Type, t.Count, len(t.Matches),
+					t.FirstSeen.Format(time.RFC3339), t.LastSeen.Format(time.RFC3339), mapped)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete <type>",
+		Short: "Delete the quarantined events of a type, such as once it is mapped",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			eventType, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("event type must be a number, got %q", args[0])
+			}
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			q, closeDB, err := openQuarantine(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			deleted, err := q.DeleteUnknownEvents(cmd.Context(), eventType)
+			if err != nil {
+				return fmt.Errorf("failed to delete unknown events of type %d. %w", eventType, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "deleted %d unknown events of type %d\n", deleted, eventType)
+			return nil
+		},
+	})
+	return cmd
+}
+
+// openQuarantine opens the configured storage for the unknown event commands.
+func openQuarantine(cmd *cobra.Command, cfg *app.Config) (database.Quarantine, func(), error) {
+	db, closeDB, err := openCommandDatabase(cmd, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, ok := db.(database.Quarantine)
+	if !ok {
+		closeDB()
+		return nil, nil, app.ErrNoQuarantine
+	}
+	return q, closeDB, nil
+}
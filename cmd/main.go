@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/imdevinc/fifa-bot/pkg/helper"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
+		reportError(os.Stderr, err)
+		cancel()
+		os.Exit(1)
+	}
+}
+
+// reportError prints the error a command failed with, as cobra would but with
+// the config's secrets redacted.
+func reportError(w io.Writer, err error) {
+	fmt.Fprintln(w, "Error:", redactor.Redact(err.Error()))
+}
+
+func newRootCmd() *cobra.Command {
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		configFile = "config.yaml"
+	}
+	root := &cobra.Command{
+		Use:          "fifa-bot",
+		Short:        "Post live FIFA match events to Slack",
+		SilenceUsage: true,
+		// main prints the error, redacted
+		SilenceErrors: true,
+		// Without a subcommand the bot runs, as it did before there were
+		// subcommands
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd.Context(), configFile, serveOptions{})
+		},
+	}
+	root.PersistentFlags().StringVarP(&configFile, "config", "c", configFile, "config file, also read from CONFIG_FILE")
+	root.AddCommand(
+		newServeCmd(&configFile),
+		newMatchesCmd(&configFile),
+		newMatchCmd(&configFile),
+		newEventsCmd(&configFile),
+		newConfigCmd(&configFile),
+		newNotifyCmd(&configFile),
+	)
+	return root
+}
+
+// logLevel is shared by every logger so a config reload can change it.
+var logLevel = new(slog.LevelVar)
+
+// redactor keeps the config's secrets out of every log line. A config reload
+// updates the secrets it knows.
+var redactor = new(helper.Redactor)
+
+// setLogLevel applies a configured level name. An unknown level falls back to
+// INFO.
+func setLogLevel(logger *slog.Logger, name string) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		logger.Warn("unexpected log level, using INFO", "level", name)
+		level = slog.LevelInfo
+	}
+	logLevel.Set(level)
+}
+
+// newLogger returns a JSON logger at the configured level that redacts the
+// config's secrets.
+func newLogger(cfg *app.Config, w io.Writer) *slog.Logger {
+	redactor.SetSecrets(cfg.Secrets()...)
+	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       logLevel,
+		ReplaceAttr: redactor.ReplaceAttr,
+	}))
+	slog.SetDefault(logger)
+	setLogLevel(logger, cfg.LogLevel)
+	return logger
+}
+
+// loadCommandConfig loads the config for the commands other than serve,
+// which log to stderr so their output can be piped.
+func loadCommandConfig(configFile string) (*app.Config, error) {
+	cfg, err := app.LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	newLogger(cfg, os.Stderr)
+	return cfg, nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/getsentry/sentry-go"
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/fifa/fifatest"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSlack records the bodies posted to it.
+type fakeSlack struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	s := &fakeSlack{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *fakeSlack) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bodies := s.bodies
+	s.bodies = nil
+	return bodies
+}
+
+// useFakeFIFA points the commands at a fake FIFA for the rest of the test.
+func useFakeFIFA(t *testing.T) *fifatest.Server {
+	server := fifatest.NewServer()
+	t.Cleanup(server.Close)
+	previous := newFIFAClient
+	newFIFAClient = server.Client
+	t.Cleanup(func() { newFIFAClient = previous })
+	return server
+}
+
+// runCLI runs the root command with args against the config in dir, and
+// returns what it wrote to stdout.
+func runCLI(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	root := newRootCmd()
+	root.SetArgs(append([]string{"-c", filepath.Join(dir, "config.yaml")}, args...))
+	root.SetOut(&out)
+	root.SetErr(io.Discard)
+	err := root.ExecuteContext(context.Background())
+	return out.String(), err
+}
+
+// withBolt opens the bolt file in dir, which the commands must not hold open.
+func withBolt(t *testing.T, dir string, f func(db database.Database)) {
+	t.Helper()
+	db, err := database.NewBoltClient(filepath.Join(dir, "fifa-bot.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	f(db)
+}
+
+func testMatch(id string) models.Match {
+	return models.Match{CompetitionId: "17", SeasonId: "1", StageId: "2", MatchId: id, HomeTeamAbbrev: "USA", AwayTeamAbbrev: "MEX"}
+}
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	slack := newFakeSlack(t)
+	fifaServer := useFakeFIFA(t)
+	fifaServer.AddMatch(testMatch("3"))
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one is booked"}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		storage string
+		setup   func(t *testing.T, db database.Database)
+		args    []string
+		wantOut []string
+		wantErr string
+		check   func(t *testing.T, db database.Database)
+	}{
+		{
+			name:    "track adds a forced match",
+			args:    []string{"match", "track", "17", "1", "2", "4", "--home", "USA", "--away", "MEX"},
+			wantOut: []string{"tracking match 4"},
+			check: func(t *testing.T, db database.Database) {
+				match, err := db.GetMatch(ctx, "4")
+				require.NoError(t, err)
+				assert.Equal(t, "USA", match.HomeTeamAbbrev)
+				controls, err := db.GetControls(ctx)
+				require.NoError(t, err)
+				assert.True(t, controls.Has(models.ControlForced, "4"))
+			},
+		},
+		{
+			name: "track forces an untracked match again",
+			setup: func(t *testing.T, db database.Database) {
+				require.NoError(t, db.AddMatch(ctx, testMatch("4")))
+				require.NoError(t, db.SetControl(ctx, models.ControlUntracked, "4", true))
+			},
+			args:    []string{"match", "track", "17", "1", "2", "4"},
+			wantOut: []string{"match 4 is already tracked"},
+			check: func(t *testing.T, db database.Database) {
+				controls, err := db.GetControls(ctx)
+				require.NoError(t, err)
+				assert.True(t, controls.Has(models.ControlForced, "4"))
+				assert.False(t, controls.Has(models.ControlUntracked, "4"))
+			},
+		},
+		{
+			name: "untrack deletes the match and keeps it untracked",
+			setup: func(t *testing.T, db database.Database) {
+				require.NoError(t, db.AddMatch(ctx, testMatch("4")))
+				require.NoError(t, db.SetControl(ctx, models.ControlForced, "4", true))
+			},
+			args:    []string{"match", "untrack", "4"},
+			wantOut: []string{"untracked match 4"},
+			check: func(t *testing.T, db database.Database) {
+				_, err := db.GetMatch(ctx, "4")
+				assert.ErrorIs(t, err, database.ErrMatchNotFound)
+				controls, err := db.GetControls(ctx)
+				require.NoError(t, err)
+				assert.True(t, controls.Has(models.ControlUntracked, "4"))
+				assert.False(t, controls.Has(models.ControlForced, "4"))
+			},
+		},
+		{
+			name:    "untrack an unknown match",
+			args:    []string{"match", "untrack", "4"},
+			wantErr: "failed to untrack match 4. match not found",
+		},
+		{
+			name:    "track rejects malformed IDs",
+			args:    []string{"match", "track", "17", "", "2", "world-cup"},
+			wantErr: `invalid match, missing season_id; not numeric FIFA IDs: match_id "world-cup"`,
+			check: func(t *testing.T, db database.Database) {
+				matches, err := db.GetAllMatches(ctx)
+				require.NoError(t, err)
+				assert.Empty(t, matches)
+			},
+		},
+		{
+			name:    "untrack rejects a malformed ID",
+			args:    []string{"match", "untrack", "4x"},
+			wantErr: `invalid match, not numeric FIFA IDs: match_id "4x"`,
+		},
+		{
+			name: "list stored matches",
+			setup: func(t *testing.T, db database.Database) {
+				require.NoError(t, db.AddMatch(ctx, testMatch("4")))
+			},
+			args:    []string{"matches", "list"},
+			wantOut: []string{"MATCH", "4      17           1       2      USA   MEX   0"},
+		},
+		{
+			name:    "dump a stored match",
+			setup:   func(t *testing.T, db database.Database) { require.NoError(t, db.AddMatch(ctx, testMatch("3"))) },
+			args:    []string{"events", "dump", "3"},
+			wantOut: []string{"5'", "YellowCard", ":large_yellow_square: Player one is booked"},
+		},
+		{
+			name:    "dump a match that is not stored",
+			storage: "memory",
+			args:    []string{"events", "dump", "3", "--competition", "17", "--season", "1", "--stage", "2"},
+			wantOut: []string{":large_yellow_square: Player one is booked"},
+		},
+		{
+			name:    "memory storage is rejected by list",
+			storage: "memory",
+			args:    []string{"matches", "list"},
+			wantErr: errMemoryStorage.Error(),
+		},
+		{
+			name:    "memory storage is rejected by track",
+			storage: "memory",
+			args:    []string{"match", "track", "17", "1", "2", "4"},
+			wantErr: errMemoryStorage.Error(),
+		},
+		{
+			name:    "memory storage is rejected by unknown events",
+			storage: "memory",
+			args:    []string{"events", "unknown"},
+			wantErr: errMemoryStorage.Error(),
+		},
+		{
+			name:    "notify test",
+			storage: "memory",
+			args:    []string{"notify", "test", "--message", "hello"},
+			wantOut: []string{"slack: ok"},
+		},
+		{
+			name:    "config validate",
+			args:    []string{"config", "validate"},
+			wantOut: []string{"warning: slack_webhook_url uses http", "is valid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			storage := tt.storage
+			if storage == "" {
+				storage = "bolt"
+			}
+			config := fmt.Sprintf("slack_webhook_url: %q\nstorage: %s\nbolt:\n  path: %q\n", slack.server.URL, storage, filepath.Join(dir, "fifa-bot.db"))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0o600))
+			if tt.setup != nil {
+				withBolt(t, dir, func(db database.Database) { tt.setup(t, db) })
+			}
+			out, err := runCLI(t, dir, tt.args...)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			for _, want := range tt.wantOut {
+				assert.Contains(t, out, want)
+			}
+			if tt.check != nil {
+				withBolt(t, dir, func(db database.Database) { tt.check(t, db) })
+			}
+		})
+	}
+	assert.Len(t, slack.take(), 1)
+}
+
+func TestServeDryRunLeavesStorageAlone(t *testing.T) {
+	mr := miniredis.RunT(t)
+	fifaServer := useFakeFIFA(t)
+	fifaServer.AddMatch(testMatch("3"))
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one is booked"}},
+	})
+	require.NoError(t, err)
+
+	// No Slack webhook, which only the --dry-run flag makes valid
+	dir := t.TempDir()
+	config := fmt.Sprintf("storage: redis\nredis:\n  address: %q\n  namespace: prod\nha:\n  enabled: true\n  instance_id: test\nsentry_dsn: \"https://public@127.0.0.1:1/1\"\n", mr.Addr())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0o600))
+	output := filepath.Join(dir, "dry-run.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := newRootCmd()
+	root.SetArgs([]string{"-c", filepath.Join(dir, "config.yaml"), "serve", "--dry-run-output", output})
+	done := make(chan error, 1)
+	go func() { done <- root.ExecuteContext(ctx) }()
+
+	require.Eventually(t, func() bool {
+		b, _ := os.ReadFile(output)
+		return strings.Contains(string(b), "match=3")
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	b, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), ":large_yellow_square: Player one is booked")
+	assert.Empty(t, mr.Keys(), "dry-run wrote to redis")
+	assert.Nil(t, sentry.CurrentHub().Client(), "dry-run initialized sentry")
+}
+
+// fakeServer records the settings a config reload applies.
+type fakeServer struct {
+	mu       sync.Mutex
+	settings app.Settings
+	applied  chan app.Settings
+}
+
+func (s *fakeServer) Settings() app.Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings
+}
+
+func (s *fakeServer) ApplySettings(settings app.Settings) {
+	s.mu.Lock()
+	s.settings = settings
+	s.mu.Unlock()
+	s.applied <- settings
+}
+
+func TestWatchConfigReloadsSlackWebhook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(webhook string) {
+		config := fmt.Sprintf("slack_webhook_url: %q\nstorage: memory\n", webhook)
+		require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	}
+	write("https://hooks.slack.com/services/first")
+	cfg, err := app.LoadConfig(path)
+	require.NoError(t, err)
+
+	server := &fakeServer{applied: make(chan app.Settings, 10)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	watchConfig(path, cfg, serveOptions{}, server, &secretRotator{}, logger)
+	write("https://hooks.slack.com/services/second")
+	select {
+	case settings := <-server.applied:
+		assert.Equal(t, "https://hooks.slack.com/services/second", settings.SlackWebhookURL)
+	case <-time.After(5 * time.Second):
+		t.Fatal("new webhook was not applied")
+	}
+}
+
+func TestReportErrorRedactsSecrets(t *testing.T) {
+	// Nothing listens on the webhook, so the send fails with an error that
+	// includes its URL
+	dir := t.TempDir()
+	webhook := "http://127.0.0.1:1/services/T000/B000/secret"
+	config := fmt.Sprintf("slack_webhook_url: %q\nstorage: memory\n", webhook)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0o600))
+
+	_, err := runCLI(t, dir, "notify", "test")
+	require.Error(t, err)
+	var out bytes.Buffer
+	reportError(&out, err)
+	assert.Contains(t, out.String(), "Error: failed to send test message to slack")
+	assert.Contains(t, out.String(), "[REDACTED]")
+	assert.NotContains(t, out.String(), "services/T000")
+}
+
+func TestNotifyTestRedactsTenantWebhooks(t *testing.T) {
+	dir := t.TempDir()
+	webhook := "http://127.0.0.1:1/services/T000/B000/secret"
+	config := fmt.Sprintf("storage: memory\ntenants:\n  - name: acme\n    slack_webhook_url: %q\n", webhook)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0o600))
+
+	out, err := runCLI(t, dir, "notify", "test")
+	require.Error(t, err)
+	assert.Contains(t, out, "slack:acme: ")
+	assert.Contains(t, out, "[REDACTED]")
+	assert.NotContains(t, out, "services/T000")
+}
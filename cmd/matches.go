@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	"github.com/spf13/cobra"
+)
+
+// These commands work on the configured storage directly. Tracking and
+// untracking go through the same helpers as the admin API, so a running bot
+// sharing the storage applies them from its next poll.
+
+// errMemoryStorage is returned by the storage commands when storage is memory,
+// as each process has its own and there is nothing to read or change.
+var errMemoryStorage = errors.New("storage is memory, which is not shared with a running bot, so there is nothing to read or change")
+
+// openCommandDatabase opens the configured storage for the commands other
+// than serve.
+func openCommandDatabase(cmd *cobra.Command, cfg *app.Config) (database.Database, func(), error) {
+	if cfg.Storage == app.StorageMemory {
+		return nil, nil, errMemoryStorage
+	}
+	return openDatabase(cmd.Context(), cfg)
+}
+
+func newMatchesCmd(configFile *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "matches",
+		Short: "Inspect stored matches",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the matches in storage",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			db, closeDB, err := openCommandDatabase(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			matches, err := db.GetAllMatches(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to get matches. %w", err)
+			}
+			slices.SortFunc(matches, func(x, y models.Match) int {
+				return strings.Compare(x.MatchId, y.MatchId)
+			})
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "MATCH\tCOMPETITION\tSEASON\tSTAGE\tHOME\tAWAY\tEVENTS")
+			for _, m := range matches {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", m.MatchId, m.CompetitionId, m.SeasonId, m.StageId, m.HomeTeamAbbrev, m.AwayTeamAbbrev, len(m.Events))
+			}
+			return w.Flush()
+		},
+	})
+	return cmd
+}
+
+func newMatchCmd(configFile *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "match",
+		Short: "Track or untrack a match in storage",
+	}
+	var home, away string
+	track := &cobra.Command{
+		Use:   "track <competition-id> <season-id> <stage-id> <match-id>",
+		Short: "Add a match to storage so the bot polls it, live or not",
+		Args:  cobra.ExactArgs(4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			db, closeDB, err := openCommandDatabase(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			match := models.Match{
+				CompetitionId:  args[0],
+				SeasonId:       args[1],
+				StageId:        args[2],
+				MatchId:        args[3],
+				HomeTeamAbbrev: home,
+				AwayTeamAbbrev: away,
+			}
+			added, err := app.TrackMatch(cmd.Context(), db, match)
+			if err != nil {
+				return fmt.Errorf("failed to track match %s. %w", match.MatchId, err)
+			}
+			if !added {
+				fmt.Fprintf(cmd.OutOrStdout(), "match %s is already tracked\n", match.MatchId)
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "tracking match %s\n", match.MatchId)
+			return nil
+		},
+	}
+	track.Flags().StringVar(&home, "home", "", "home team abbreviation used in messages")
+	track.Flags().StringVar(&away, "away", "", "away team abbreviation used in messages")
+	cmd.AddCommand(track, &cobra.Command{
+		Use:   "untrack <match-id>",
+		Short: "Delete a match and its processed events from storage, and stop the bot polling it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			db, closeDB, err := openCommandDatabase(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			defer closeDB()
+			if err := app.UntrackMatch(cmd.Context(), db, args[0]); err != nil {
+				return fmt.Errorf("failed to untrack match %s. %w", args[0], err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "untracked match %s\n", args[0])
+			return nil
+		},
+	})
+	return cmd
+}
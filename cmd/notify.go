@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/spf13/cobra"
+)
+
+func newNotifyCmd(configFile *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Check notification destinations",
+	}
+	var text string
+	test := &cobra.Command{
+		Use:   "test",
+		Short: "Send a sample message to each configured destination",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCommandConfig(*configFile)
+			if err != nil {
+				return err
+			}
+			// Slack is the only destination so far, once per tenant
+			if len(cfg.Tenants) == 0 {
+				if err := app.PostToSlack(cfg.SlackWebhookURL, text); err != nil {
+					return fmt.Errorf("failed to send test message to slack. %w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "slack: ok")
+				return nil
+			}
+			failed := 0
+			for _, tenant := range cfg.Tenants {
+				if err := app.PostToSlack(tenant.SlackWebhookURL, text); err != nil {
+					// The error includes the webhook
+					fmt.Fprintf(cmd.OutOrStdout(), "slack:%s: %s\n", tenant.Name, redactor.Redact(err.Error()))
+					failed++
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "slack:%s: ok\n", tenant.Name)
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to send test message to %d of %d tenants", failed, len(cfg.Tenants))
+			}
+			return nil
+		},
+	}
+	test.Flags().StringVar(&text, "message", ":soccer: Test message from fifa-bot", "message to send")
+	cmd.AddCommand(test)
+	return cmd
+}
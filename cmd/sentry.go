@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"os"
+	"runtime/debug"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/imdevinc/fifa-bot/pkg/app"
+)
+
+// sentryOptions configures Sentry for cfg. The release is taken from
+// SENTRY_RELEASE, or else from the build info.
+func sentryOptions(cfg *app.Config) sentry.ClientOptions {
+	return sentry.ClientOptions{
+		Dsn:         cfg.SentryDSN,
+		Release:     cmp.Or(os.Getenv("SENTRY_RELEASE"), buildRelease()),
+		Environment: cfg.SentryEnvironment,
+		BeforeSend:  redactEvent,
+	}
+}
+
+// redactEvent keeps the config's secrets out of what is sent to Sentry, such
+// as a webhook URL in the error of a failed notification.
+func redactEvent(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	event.Message = redactor.Redact(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = redactor.Redact(event.Exception[i].Value)
+	}
+	redactValues(event.Extra)
+	for _, crumb := range event.Breadcrumbs {
+		crumb.Message = redactor.Redact(crumb.Message)
+		redactValues(crumb.Data)
+	}
+	return event
+}
+
+// redactValues redacts the strings and errors in values.
+func redactValues(values map[string]interface{}) {
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			values[key] = redactor.Redact(v)
+		case error:
+			values[key] = redactor.Redact(v.Error())
+		}
+	}
+}
+
+// buildRelease names the running build as "fifa-bot@<version>", using the
+// module version when built with go install and the VCS revision otherwise.
+// It is empty when the binary carries no build info.
+func buildRelease() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return "fifa-bot@" + info.Main.Version
+	}
+	var revision string
+	var modified bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return ""
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return "fifa-bot@" + revision
+}
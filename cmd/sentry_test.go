@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/imdevinc/fifa-bot/pkg/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentryRedactsSecrets(t *testing.T) {
+	webhook := "https://hooks.slack.com/services/T000/B000/secret"
+	redactor.SetSecrets(webhook)
+	t.Cleanup(func() { redactor.SetSecrets() })
+
+	var sent *sentry.Event
+	options := sentryOptions(&app.Config{})
+	before := options.BeforeSend
+	options.BeforeSend = func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		sent = before(event, hint)
+		return nil
+	}
+	client, err := sentry.NewClient(options)
+	require.NoError(t, err)
+	hub := sentry.NewHub(client, sentry.NewScope())
+
+	hub.AddBreadcrumb(&sentry.Breadcrumb{Message: "posting to " + webhook, Data: map[string]interface{}{"url": webhook, "error": errors.New("Post " + webhook)}}, nil)
+	hub.Scope().SetExtra("webhook", webhook)
+	hub.CaptureException(errors.New("failed to post to " + webhook))
+	require.NotNil(t, sent)
+	require.NotEmpty(t, sent.Exception)
+	assert.Equal(t, "failed to post to [REDACTED]", sent.Exception[0].Value)
+	assert.Equal(t, "[REDACTED]", sent.Extra["webhook"])
+	require.Len(t, sent.Breadcrumbs, 1)
+	assert.Equal(t, "posting to [REDACTED]", sent.Breadcrumbs[0].Message)
+	assert.Equal(t, map[string]interface{}{"url": "[REDACTED]", "error": "Post [REDACTED]"}, sent.Breadcrumbs[0].Data)
+
+	hub.CaptureMessage("webhook " + webhook + " returned 404")
+	assert.Equal(t, "webhook [REDACTED] returned 404", sent.Message)
+}
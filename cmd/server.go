@@ -1,42 +1,134 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
-	"log"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"reflect"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/imdevinc/fifa-bot/pkg/app"
 	"github.com/imdevinc/fifa-bot/pkg/database"
 	"github.com/imdevinc/fifa-bot/pkg/fifa"
-	go_fifa "github.com/imdevinc/go-fifa"
+	"github.com/imdevinc/fifa-bot/pkg/helper"
+	"github.com/imdevinc/fifa-bot/pkg/leader"
+	"github.com/imdevinc/fifa-bot/pkg/shard"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
 	_ "net/http/pprof"
 )
 
-func main() {
-	configFile := os.Getenv("CONFIG_FILE")
-	if configFile == "" {
-		configFile = "config.yaml"
+// serveOptions are the serve flags that override the config file.
+type serveOptions struct {
+	dryRun       bool
+	dryRunOutput string
+}
+
+// apply overrides cfg with the flags. LoadConfig then applies what dry-run
+// mode implies before validating it.
+func (opts serveOptions) apply(cfg *app.Config) {
+	if opts.dryRun || opts.dryRunOutput != "" {
+		cfg.DryRun = true
+	}
+	if opts.dryRunOutput != "" {
+		cfg.DryRunOutput = opts.dryRunOutput
+	}
+}
+
+func newServeCmd(configFile *string) *cobra.Command {
+	var opts serveOptions
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Poll FIFA for live matches and post their events",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(cmd.Context(), *configFile, opts)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "write messages to stdout or --dry-run-output instead of Slack, and keep state in memory")
+	cmd.Flags().StringVar(&opts.dryRunOutput, "dry-run-output", "", "file to append dry-run messages to, implies --dry-run")
+	return cmd
+}
+
+// openDatabase connects to the configured storage. The returned function
+// closes it.
+func openDatabase(ctx context.Context, cfg *app.Config) (database.Database, func(), error) {
+	matchTTL := time.Duration(cfg.MatchTTLHours) * time.Hour
+	switch cfg.Storage {
+	case app.StorageMemory:
+		memDB := database.NewMemoryClient()
+		memDB.SetMatchTTL(matchTTL)
+		return memDB, func() {}, nil
+	case app.StorageBolt:
+		boltDB, err := database.NewBoltClient(cfg.Bolt.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open database file %s. %w", cfg.Bolt.Path, err)
+		}
+		boltDB.SetMatchTTL(matchTTL)
+		return boltDB, func() { boltDB.Close() }, nil
+	case app.StoragePostgres:
+		pgDB, err := database.NewPostgresClient(ctx, cfg.Postgres.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to postgres. %w", err)
+		}
+		pgDB.SetMatchTTL(matchTTL)
+		return pgDB, pgDB.Close, nil
+	default:
+		redisDB := database.NewRedisClient(cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.Database, cfg.Redis.Namespace)
+		redisDB.SetMatchTTL(matchTTL)
+		return redisDB, func() {}, nil
 	}
-	cfg, err := app.LoadConfig(configFile)
+}
+
+func runServe(ctx context.Context, configFile string, opts serveOptions) error {
+	cfg, err := app.LoadConfig(configFile, opts.apply)
 	if err != nil {
-		log.Fatal("failed to load config", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to load config. %w", err)
 	}
-	var level slog.Level
-	err = level.UnmarshalText([]byte(cfg.LogLevel))
+	// Dry-run messages go to stdout by default, so logs are kept apart
+	logOutput := os.Stdout
+	if cfg.DryRun {
+		logOutput = os.Stderr
+	}
+	logger := newLogger(cfg, logOutput)
+	if cfg.DryRun {
+		logger.Warn("dry-run mode, messages are not sent and state is kept in memory", "output", cmp.Or(cfg.DryRunOutput, "stdout"))
+	} else if cfg.Storage == app.StorageMemory {
+		logger.Warn("using in-memory storage, match state will not survive a restart")
+	}
+	db, closeDB, err := openDatabase(ctx, cfg)
 	if err != nil {
-		log.Printf("unexpected log level: %s", cfg.LogLevel)
-		level = slog.LevelInfo
+		logger.Error("failed to open storage", "error", err)
+		return err
+	}
+	defer closeDB()
+	if migrator, ok := db.(interface {
+		MigrateUnprefixedKeys(context.Context) (int, error)
+	}); ok && cfg.Redis.MigrateUnprefixedKeys {
+		moved, err := migrator.MigrateUnprefixedKeys(ctx)
+		if err != nil {
+			logger.Error("failed to migrate unprefixed redis keys", "error", err)
+			return err
+		}
+		logger.Info("migrated unprefixed redis keys", "namespace", cfg.Redis.Namespace, "keys", moved)
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
-	slog.SetDefault(logger)
-	db := database.NewRedisClient(cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.Database)
-	fc := go_fifa.Client{}
+	if validator, ok := db.(database.Validator); ok {
+		invalid, err := validator.ValidateMatches(ctx)
+		if err != nil {
+			logger.Error("failed to validate stored matches", "error", err)
+		}
+		for _, m := range invalid {
+			logger.Error("stored match cannot be decoded and will be ignored", "matchId", m.MatchID, "error", m.Err)
+		}
+	}
+	fc := newFIFAClient()
 
 	if cfg.EnableProfiling {
 		go func() {
@@ -48,29 +140,250 @@ func main() {
 		}()
 	}
 
-	skipSet, err := fifa.ParseEventNames(cfg.SkipEvents)
-	if err != nil {
-		logger.Warn("invalid skip_events entry, skipping unknown names", "error", err)
-	}
+	logConfigWarnings(cfg, logger)
+	customEvents := app.CustomEventsFromConfig(cfg)
+	// Unknown names were reported as config warnings and are left out
+	skipSet, _ := fifa.ParseEventNamesWith(cfg.SkipEvents, customEvents)
 
 	sentryEnabled := false
-	if cfg.SentryDSN != "" {
-		err := sentry.Init(sentry.ClientOptions{
-			Dsn: cfg.SentryDSN,
-		})
+	if cfg.SentryDSN != "" && cfg.DryRun {
+		logger.Info("sentry is disabled in dry-run mode")
+	} else if cfg.SentryDSN != "" {
+		options := sentryOptions(cfg)
+		err := sentry.Init(options)
 		if err != nil {
 			logger.Error("failed to initialize sentry", "error", err)
 		} else {
 			sentryEnabled = true
-			logger.Info("sentry initialized", "dsn", cfg.SentryDSN)
+			logger.Info("sentry initialized", "release", options.Release, "environment", options.Environment)
 			defer sentry.Flush(2 * time.Second)
 		}
 	}
 
-	server := app.New(db, &fc, cfg.SlackWebhookURL, cfg.CompetitionID, cfg.SleepTimeSeconds, skipSet, sentryEnabled)
-	if err := server.Run(context.Background()); err != nil {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err := helper.InitTracing(ctx, helper.TracingConfig{
+			Endpoint:    cfg.Tracing.Endpoint,
+			Insecure:    cfg.Tracing.Insecure,
+			SampleRatio: cfg.Tracing.SampleRatio,
+			ServiceName: cfg.Tracing.ServiceName,
+		})
+		if err != nil {
+			logger.Error("failed to initialize tracing", "error", err)
+		} else {
+			logger.Info("tracing enabled", "endpoint", cfg.Tracing.Endpoint)
+			defer func() {
+				// ctx is already cancelled by the time this runs
+				flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer flushCancel()
+				if err := shutdownTracing(flushCtx); err != nil {
+					logger.Error("failed to flush traces", "error", err)
+				}
+			}()
+		}
+	}
+
+	server := app.New(db, fc, cfg.SlackWebhookURL, cfg.CompetitionID, cfg.SleepTimeSeconds, skipSet, sentryEnabled)
+	server.SetStaleMatchGrace(time.Duration(cfg.StaleMatchGraceMinutes) * time.Minute)
+	settings := server.Settings()
+	settings.Tenants = app.TenantsFromConfig(cfg)
+	settings.CustomEvents = customEvents
+	server.ApplySettings(settings)
+	if len(cfg.Tenants) > 0 {
+		logger.Info("multi-tenant mode enabled", "tenants", len(cfg.Tenants))
+	}
+	server.SetRedactor(redactor)
+	rotator := &secretRotator{db: db, sentryEnabled: sentryEnabled}
+	rotator.coordPassword.Store(&cfg.Redis.Password)
+	watchConfig(configFile, cfg, opts, server, rotator, logger)
+	if cfg.DryRun {
+		out := io.Writer(os.Stdout)
+		if cfg.DryRunOutput != "" {
+			f, err := os.OpenFile(cfg.DryRunOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				logger.Error("failed to open dry-run output", "path", cfg.DryRunOutput, "error", err)
+				return fmt.Errorf("failed to open dry-run output %s. %w", cfg.DryRunOutput, err)
+			}
+			defer f.Close()
+			out = f
+		}
+		server.SetDryRun(out)
+	}
+	var coordClient *redis.Client
+	if cfg.HA.Enabled || cfg.Shard.Enabled {
+		coordClient = redis.NewClient(&redis.Options{
+			Addr: cfg.Redis.Address,
+			DB:   cfg.Redis.Database,
+			CredentialsProvider: func() (string, string) {
+				return "", *rotator.coordPassword.Load()
+			},
+		})
+		defer coordClient.Close()
+	}
+	coordKey := func(name string) string {
+		if cfg.Redis.Namespace == "" {
+			return name
+		}
+		return cfg.Redis.Namespace + ":" + name
+	}
+	if cfg.HA.Enabled {
+		leaseKey := coordKey("leader")
+		lease := leader.NewLease(coordClient, leaseKey, cfg.HA.InstanceID, time.Duration(cfg.HA.LeaseTTLSeconds)*time.Second)
+		leaseDone := make(chan struct{})
+		go func() {
+			lease.Run(ctx)
+			close(leaseDone)
+		}()
+		// Give the lease back on shutdown so the standby does not wait for it
+		// to expire
+		defer func() { <-leaseDone }()
+		defer cancel()
+		server.SetLeader(lease)
+		logger.Info("high-availability mode enabled", "instance", cfg.HA.InstanceID, "lease_key", leaseKey)
+	}
+	if cfg.Shard.Enabled {
+		membership := shard.NewMembership(coordClient, coordKey("workers"), cfg.Shard.WorkerID, time.Duration(cfg.Shard.HeartbeatTTLSeconds)*time.Second)
+		membershipDone := make(chan struct{})
+		go func() {
+			membership.Run(ctx)
+			close(membershipDone)
+		}()
+		// Leave the ring on shutdown so the other workers pick up our matches
+		// straight away
+		defer func() { <-membershipDone }()
+		defer cancel()
+		server.SetSharder(membership)
+		logger.Info("sharded mode enabled", "worker", cfg.Shard.WorkerID)
+	}
+	if cfg.EnableOpsServer {
+		if cfg.AdminToken != "" {
+			server.SetAdminToken(cfg.AdminToken)
+			logger.Info("admin API enabled")
+		}
+		opsServer := &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.OpsPort),
+			Handler: server.OpsHandler(),
+		}
+		go func() {
+			logger.Info("starting ops server", "port", cfg.OpsPort)
+			if err := opsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("ops server failed", "error", err)
+			}
+		}()
+		defer opsServer.Close()
+	}
+	if err := server.Run(ctx); err != nil {
 		logger.Error("server failed", "error", err)
-		os.Exit(1)
+		return err
+	}
+	return nil
+}
+
+// reconfigurable is the part of the app a config reload changes.
+type reconfigurable interface {
+	Settings() app.Settings
+	ApplySettings(app.Settings)
+}
+
+// secretRotator hands secrets re-read from their files to the clients that
+// were created with them.
+type secretRotator struct {
+	db database.Database
+	// coordPassword is read by the HA and shard Redis client for each new
+	// connection
+	coordPassword atomic.Pointer[string]
+	sentryEnabled bool
+}
+
+// rotate applies the secrets in field that changed between prev and next, and
+// reports whether they were the only change to field.
+func (r *secretRotator) rotate(field string, prev *app.Config, next *app.Config) (bool, error) {
+	switch field {
+	case "redis":
+		withPassword := *prev
+		withPassword.Redis.Password = next.Redis.Password
+		if !reflect.DeepEqual(withPassword.Redis, next.Redis) {
+			return false, nil
+		}
+		if rotatable, ok := r.db.(interface{ SetPassword(string) }); ok {
+			rotatable.SetPassword(next.Redis.Password)
+		}
+		r.coordPassword.Store(&next.Redis.Password)
+		return true, nil
+	case "sentry_dsn":
+		// The app only reports to Sentry if it was enabled on startup
+		if !r.sentryEnabled || next.SentryDSN == "" {
+			return false, nil
+		}
+		if err := sentry.Init(sentryOptions(next)); err != nil {
+			return false, fmt.Errorf("failed to initialize sentry. %w", err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// watchConfig applies changes to the config file, and to the secret files it
+// names, that are safe to make while running, and logs the ones that need a
+// restart.
+func watchConfig(configFile string, cfg *app.Config, opts serveOptions, server reconfigurable, rotator *secretRotator, logger *slog.Logger) {
+	running := cfg
+	app.WatchConfig(configFile, func(next *app.Config) {
+		// Old secrets may still turn up in errors from requests in flight
+		redactor.SetSecrets(slices.Concat(running.Secrets(), next.Secrets())...)
+		var live, rotated, restart []string
+		for _, field := range app.ChangedConfigFields(running, next) {
+			if slices.Contains(app.LiveConfigFields, field) {
+				live = append(live, field)
+				continue
+			}
+			ok, err := rotator.rotate(field, running, next)
+			if err != nil {
+				logger.Error("failed to rotate secret", "field", field, "error", err)
+			}
+			if ok {
+				rotated = append(rotated, field)
+			} else {
+				restart = append(restart, field)
+			}
+		}
+		running = next
+		if len(rotated) > 0 {
+			logger.Info("rotated secrets", "fields", rotated)
+		}
+		if len(restart) > 0 {
+			logger.Warn("config changes need a restart to take effect", "fields", restart)
+		}
+		if len(live) == 0 {
+			return
+		}
+		logConfigWarnings(next, logger)
+		customEvents := app.CustomEventsFromConfig(next)
+		skipSet, _ := fifa.ParseEventNamesWith(next.SkipEvents, customEvents)
+		settings := server.Settings()
+		settings.SlackWebhookURL = next.SlackWebhookURL
+		settings.CompetitionID = next.CompetitionID
+		settings.PollInterval = time.Duration(next.SleepTimeSeconds) * time.Second
+		settings.EventsToSkip = skipSet
+		settings.StaleMatchGrace = time.Duration(next.StaleMatchGraceMinutes) * time.Minute
+		settings.Tenants = app.TenantsFromConfig(next)
+		settings.CustomEvents = customEvents
+		server.ApplySettings(settings)
+		setLogLevel(logger, next.LogLevel)
+		logger.Info("applied config changes", "fields", live)
+	}, func(err error) {
+		logger.Error("failed to reload config, keeping the running config", "error", err)
+	}, opts.apply)
+}
+
+// logConfigWarnings logs the settings in cfg that are probably mistakes.
+func logConfigWarnings(cfg *app.Config, logger *slog.Logger) {
+	// LoadConfig already failed on any problem, so only warnings are left
+	warnings, _ := cfg.Validate(false)
+	for _, warning := range warnings {
+		logger.Warn("config warning", "warning", warning)
 	}
 }
 
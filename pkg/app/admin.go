@@ -0,0 +1,394 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+var (
+	// ErrInvalidMatch is returned when tracking a match without the IDs
+	// needed to poll it, or with IDs that are not FIFA IDs.
+	ErrInvalidMatch = errors.New("invalid match")
+	// ErrEventNotFound is returned when a match has no record of the event.
+	ErrEventNotFound = errors.New("event not found")
+	// ErrNothingToSend is returned when re-sending an event that was skipped
+	// or unknown, so no message was rendered for it.
+	ErrNothingToSend = errors.New("event has no message to send")
+)
+
+// SetAdminToken enables the admin endpoints on the ops handler. Requests must
+// carry the token as a bearer token.
+func (a *app) SetAdminToken(token string) {
+	a.adminToken = token
+}
+
+// TrackedMatch is a stored match along with the admin controls applied to it.
+type TrackedMatch struct {
+	models.Match
+	// Forced is set for matches tracked through the admin API, which are not
+	// retired when FIFA does not list them as live.
+	Forced bool `json:"forced"`
+	Paused bool `json:"paused"`
+}
+
+// Matches returns the matches in storage, ordered by match ID. Storage is
+// shared, so this includes the matches polled by other instances.
+func (a *app) Matches(ctx context.Context) ([]TrackedMatch, error) {
+	stored, err := a.db.GetAllMatches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matches. %w", err)
+	}
+	controls, err := a.db.GetControls(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin controls. %w", err)
+	}
+	matches := make([]TrackedMatch, 0, len(stored))
+	for _, m := range stored {
+		matches = append(matches, TrackedMatch{
+			Match:  m,
+			Forced: controls.Has(models.ControlForced, m.MatchId),
+			Paused: controls.Has(models.ControlPaused, "") || controls.Has(models.ControlPaused, m.MatchId),
+		})
+	}
+	slices.SortFunc(matches, func(x, y TrackedMatch) int {
+		return strings.Compare(x.MatchId, y.MatchId)
+	})
+	return matches, nil
+}
+
+// storedMatch returns database.ErrMatchNotFound if the match is not in
+// storage.
+func storedMatch(ctx context.Context, db database.Database, matchID string) error {
+	_, err := db.GetMatch(ctx, matchID)
+	if err != nil && !errors.Is(err, database.ErrMatchNotFound) {
+		return fmt.Errorf("failed to get match %s. %w", matchID, err)
+	}
+	return err
+}
+
+// checkMatchIDs returns ErrInvalidMatch unless every ID, by name, is a
+// numeric FIFA ID.
+func checkMatchIDs(ids map[string]string) error {
+	var missing, malformed []string
+	for _, name := range slices.Sorted(maps.Keys(ids)) {
+		switch id := ids[name]; {
+		case id == "":
+			missing = append(missing, name)
+		case !isFIFAID(id):
+			malformed = append(malformed, fmt.Sprintf("%s %q", name, id))
+		}
+	}
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(malformed) > 0 {
+		problems = append(problems, "not numeric FIFA IDs: "+strings.Join(malformed, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w, %s", ErrInvalidMatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func isFIFAID(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// TrackMatch stores a match in db and has it polled whether or not FIFA lists
+// it as live, from the next poll of whichever bot sharing db processes it.
+// The competition, season, stage and match IDs are required. A match that is
+// already stored keeps its processed events. It reports whether the match
+// was added.
+func TrackMatch(ctx context.Context, db database.Database, match models.Match) (bool, error) {
+	err := checkMatchIDs(map[string]string{
+		"competition_id": match.CompetitionId,
+		"season_id":      match.SeasonId,
+		"stage_id":       match.StageId,
+		"match_id":       match.MatchId,
+	})
+	if err != nil {
+		return false, err
+	}
+	err = storedMatch(ctx, db, match.MatchId)
+	added := errors.Is(err, database.ErrMatchNotFound)
+	if added {
+		match.Events = nil
+		err = db.AddMatch(ctx, match)
+		if err != nil {
+			return false, fmt.Errorf("failed to add match %s to database. %w", match.MatchId, err)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := db.SetControl(ctx, models.ControlForced, match.MatchId, true); err != nil {
+		return added, fmt.Errorf("failed to force match %s. %w", match.MatchId, err)
+	}
+	if err := db.SetControl(ctx, models.ControlUntracked, match.MatchId, false); err != nil {
+		return added, fmt.Errorf("failed to clear untracked match %s. %w", match.MatchId, err)
+	}
+	return added, nil
+}
+
+// UntrackMatch stops every bot sharing db from polling a match and deletes it
+// from the database. It is not picked up again while FIFA lists it as live,
+// unless it is tracked again.
+func UntrackMatch(ctx context.Context, db database.Database, matchID string) error {
+	if err := checkMatchIDs(map[string]string{"match_id": matchID}); err != nil {
+		return err
+	}
+	if err := storedMatch(ctx, db, matchID); err != nil {
+		return err
+	}
+	// Set first, so that no bot picks the match up again in between
+	if err := db.SetControl(ctx, models.ControlUntracked, matchID, true); err != nil {
+		return fmt.Errorf("failed to untrack match %s. %w", matchID, err)
+	}
+	if err := db.DeleteMatch(ctx, matchID); err != nil {
+		return fmt.Errorf("failed to delete match %s. %w", matchID, err)
+	}
+	// So they do not apply if its ID is tracked again
+	for _, control := range untrackedControls {
+		if err := db.SetControl(ctx, control, matchID, false); err != nil {
+			return fmt.Errorf("failed to clear %s control of match %s. %w", control, matchID, err)
+		}
+	}
+	return nil
+}
+
+// TrackMatch is TrackMatch on the app's database, applied to this instance
+// right away.
+func (a *app) TrackMatch(ctx context.Context, match models.Match) error {
+	if _, err := TrackMatch(ctx, a.db, match); err != nil {
+		return err
+	}
+	a.matchMutex.Lock()
+	a.controls.Set(models.ControlForced, match.MatchId, true)
+	a.controls.Set(models.ControlUntracked, match.MatchId, false)
+	a.matchMutex.Unlock()
+	slog.Info("match tracked by admin", "matchId", match.MatchId)
+	return nil
+}
+
+// UntrackMatch is UntrackMatch on the app's database, applied to this
+// instance right away.
+func (a *app) UntrackMatch(ctx context.Context, matchID string) error {
+	if err := UntrackMatch(ctx, a.db, matchID); err != nil {
+		return err
+	}
+	a.forgetMatch(matchID)
+	a.matchMutex.Lock()
+	a.controls.Set(models.ControlUntracked, matchID, true)
+	for _, control := range untrackedControls {
+		a.controls.Set(control, matchID, false)
+	}
+	a.matchMutex.Unlock()
+	slog.Info("match untracked by admin", "matchId", matchID)
+	return nil
+}
+
+// ResetMatchEvents forgets which events of a match were processed, along with
+// their records. The reset is queued in storage and carried out by the
+// instance tracking the match before it next polls it, so it never races with
+// the match being processed. Every event on the timeline is then announced
+// again unless notifications are paused.
+func (a *app) ResetMatchEvents(ctx context.Context, matchID string) error {
+	if err := storedMatch(ctx, a.db, matchID); err != nil {
+		return err
+	}
+	if err := a.setControl(ctx, models.ControlReset, matchID, true); err != nil {
+		return err
+	}
+	slog.Info("match events reset queued by admin", "matchId", matchID)
+	return nil
+}
+
+// ResendEvent sends the stored message of an event again, to every tenant
+// following the match that does not skip the event type. It is sent even if
+// notifications are paused.
+func (a *app) ResendEvent(ctx context.Context, matchID string, eventID string) error {
+	records, err := a.db.GetEventRecords(ctx, matchID)
+	if err != nil {
+		return fmt.Errorf("failed to get event records for match %s. %w", matchID, err)
+	}
+	idx := slices.IndexFunc(records, func(r models.EventRecord) bool { return r.EventID == eventID })
+	if idx < 0 {
+		return ErrEventNotFound
+	}
+	record := records[idx]
+	if strings.TrimSpace(record.Message) == "" {
+		return ErrNothingToSend
+	}
+	a.matchMutex.Lock()
+	match, exists := a.matches[matchID]
+	a.matchMutex.Unlock()
+	if !exists {
+		if match, err = a.db.GetMatch(ctx, matchID); err != nil {
+			return fmt.Errorf("failed to get match %s. %w", matchID, err)
+		}
+	}
+	recipients := a.settings().recipients(match.CompetitionId, go_fifa.MatchEvent(record.Type))
+	if len(recipients) == 0 {
+		return ErrNothingToSend
+	}
+	var errs []error
+	for _, tenant := range recipients {
+		err := a.deliver(tenant, matchID, eventID, record.Message)
+		a.health.recordNotification(a.now(), err)
+		a.recordNotification(ctx, matchID, eventID, a.destination(tenant), err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to send event %s. %w", eventID, err)
+	}
+	slog.Info("event re-sent by admin", "matchId", matchID, "eventId", eventID)
+	return nil
+}
+
+// PauseNotifications stops sending messages for a match, or for every match
+// when matchID is empty. Events keep being processed while paused and are not
+// sent later.
+func (a *app) PauseNotifications(ctx context.Context, matchID string) error {
+	if matchID != "" {
+		if err := storedMatch(ctx, a.db, matchID); err != nil {
+			return err
+		}
+	}
+	return a.setControl(ctx, models.ControlPaused, matchID, true)
+}
+
+// ResumeNotifications undoes PauseNotifications. Resuming every match also
+// clears the pauses of single matches.
+func (a *app) ResumeNotifications(ctx context.Context, matchID string) error {
+	if matchID != "" {
+		return a.setControl(ctx, models.ControlPaused, matchID, false)
+	}
+	controls, err := a.db.GetControls(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get admin controls. %w", err)
+	}
+	for id := range controls[models.ControlPaused] {
+		if err := a.setControl(ctx, models.ControlPaused, id, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *app) registerAdminRoutes(mux *http.ServeMux) {
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, a.requireAdmin(h))
+	}
+	handle("GET /admin/matches", func(w http.ResponseWriter, r *http.Request) {
+		matches, err := a.Matches(r.Context())
+		if err != nil {
+			a.writeAdminResult(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, matches)
+	})
+	handle("POST /admin/matches", func(w http.ResponseWriter, r *http.Request) {
+		var match models.Match
+		if err := json.NewDecoder(r.Body).Decode(&match); err != nil {
+			a.writeAdminError(w, http.StatusBadRequest, fmt.Errorf("failed to decode match. %w", err))
+			return
+		}
+		a.writeAdminResult(w, a.TrackMatch(r.Context(), match))
+	})
+	handle("DELETE /admin/matches/{id}", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.UntrackMatch(r.Context(), r.PathValue("id")))
+	})
+	handle("POST /admin/matches/{id}/reset", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.ResetMatchEvents(r.Context(), r.PathValue("id")))
+	})
+	handle("POST /admin/matches/{id}/events/{event}/resend", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.ResendEvent(r.Context(), r.PathValue("id"), r.PathValue("event")))
+	})
+	handle("GET /admin/unknown-events", func(w http.ResponseWriter, r *http.Request) {
+		types, err := a.UnknownEventTypes(r.Context())
+		if err != nil {
+			a.writeAdminResult(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, types)
+	})
+	handle("DELETE /admin/unknown-events/{type}", func(w http.ResponseWriter, r *http.Request) {
+		eventType, err := strconv.Atoi(r.PathValue("type"))
+		if err != nil {
+			a.writeAdminError(w, http.StatusBadRequest, fmt.Errorf("event type must be a number, got %q", r.PathValue("type")))
+			return
+		}
+		deleted, err := a.DeleteUnknownEvents(r.Context(), eventType)
+		if err != nil {
+			a.writeAdminResult(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+	})
+	handle("POST /admin/pause", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.PauseNotifications(r.Context(), ""))
+	})
+	handle("POST /admin/resume", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.ResumeNotifications(r.Context(), ""))
+	})
+	handle("POST /admin/matches/{id}/pause", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.PauseNotifications(r.Context(), r.PathValue("id")))
+	})
+	handle("POST /admin/matches/{id}/resume", func(w http.ResponseWriter, r *http.Request) {
+		a.writeAdminResult(w, a.ResumeNotifications(r.Context(), r.PathValue("id")))
+	})
+}
+
+// requireAdmin rejects requests that do not carry the admin token.
+func (a *app) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			a.writeAdminError(w, http.StatusUnauthorized, errors.New("missing or invalid admin token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func (a *app) writeAdminResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, database.ErrMatchNotFound), errors.Is(err, ErrEventNotFound):
+		a.writeAdminError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrInvalidMatch):
+		a.writeAdminError(w, http.StatusBadRequest, err)
+	case errors.Is(err, ErrNothingToSend):
+		a.writeAdminError(w, http.StatusConflict, err)
+	case errors.Is(err, ErrNoQuarantine):
+		a.writeAdminError(w, http.StatusNotImplemented, err)
+	default:
+		a.writeAdminError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (a *app) writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, adminError{Error: a.redactor.Redact(err.Error())})
+}
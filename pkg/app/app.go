@@ -8,111 +8,284 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/imdevinc/fifa-bot/pkg/database"
 	"github.com/imdevinc/fifa-bot/pkg/fifa"
+	"github.com/imdevinc/fifa-bot/pkg/helper"
+	"github.com/imdevinc/fifa-bot/pkg/metrics"
 	"github.com/imdevinc/fifa-bot/pkg/models"
 	go_fifa "github.com/imdevinc/go-fifa"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
 type app struct {
-	db               database.Database
-	fifa             *go_fifa.Client
-	slackWebhookURL  string
-	CompetitionId    string
-	matches          map[string]models.Match
-	sleepTimeSeconds time.Duration
-	eventsToSkip     map[go_fifa.MatchEvent]bool
-	matchMutex       *sync.Mutex
-	sentryEnabled    bool
+	db            database.Database
+	fifa          *go_fifa.Client
+	matches       map[string]models.Match
+	matchMutex    *sync.Mutex
+	sentryEnabled bool
+	leader        Leader
+	sharder       Sharder
+	// lastSeenLive is when FIFA last listed each tracked match as live.
+	// Guarded by matchMutex.
+	lastSeenLive map[string]time.Time
+	now          func() time.Time
+	health       *health
+	// current holds the settings that can change while running
+	current atomic.Pointer[Settings]
+	// dryRun, when set, receives messages instead of Slack
+	dryRun *dryRun
+	// controls are the admin controls as last read from storage, at the start
+	// of every poll. Guarded by matchMutex.
+	controls   models.Controls
+	adminToken string
+	// breadcrumbs are the recent events of each match, attached to what is
+	// captured to Sentry for it. Guarded by matchMutex.
+	breadcrumbs map[string][]*sentry.Breadcrumb
+	// redactor hides secrets in the errors served by the ops endpoints
+	redactor *helper.Redactor
+}
+
+// DefaultStaleMatchGrace is how long a tracked match can be missing from
+// FIFA's live matches before it is retired.
+const DefaultStaleMatchGrace = 30 * time.Minute
+
+// Leader reports whether this instance is the one that should poll FIFA and
+// send notifications. See leader.Lease.
+type Leader interface {
+	IsLeader() bool
+}
+
+// Sharder reports whether this worker is responsible for a match when
+// matches are spread across several workers. See shard.Membership.
+type Sharder interface {
+	Owns(matchID string) bool
 }
 
 func New(db database.Database, fifa *go_fifa.Client, slackWebhookURL string, competitionId string, sleepTimeSeconds int, eventsToSkip map[go_fifa.MatchEvent]bool, sentryEnabled bool) *app {
-	if eventsToSkip == nil {
-		eventsToSkip = make(map[go_fifa.MatchEvent]bool)
-	}
-	return &app{
-		db:               db,
-		fifa:             fifa,
-		slackWebhookURL:  slackWebhookURL,
-		CompetitionId:    competitionId,
-		matches:          map[string]models.Match{},
-		sleepTimeSeconds: time.Duration(sleepTimeSeconds),
-		eventsToSkip:     eventsToSkip,
-		matchMutex:       &sync.Mutex{},
-		sentryEnabled:    sentryEnabled,
+	a := &app{
+		db:            db,
+		fifa:          fifa,
+		matches:       map[string]models.Match{},
+		matchMutex:    &sync.Mutex{},
+		sentryEnabled: sentryEnabled,
+		lastSeenLive:  map[string]time.Time{},
+		now:           time.Now,
+		health:        newHealth(),
+		controls:      models.Controls{},
+		breadcrumbs:   map[string][]*sentry.Breadcrumb{},
 	}
+	a.ApplySettings(Settings{
+		SlackWebhookURL: slackWebhookURL,
+		CompetitionID:   competitionId,
+		PollInterval:    time.Duration(sleepTimeSeconds) * time.Second,
+		EventsToSkip:    eventsToSkip,
+		StaleMatchGrace: DefaultStaleMatchGrace,
+	})
+	return a
 }
 
-func (a *app) Run(ctx context.Context) error {
+// SetStaleMatchGrace sets how long a tracked match can be missing from FIFA's
+// live matches before it is retired, for matches whose end is never reported.
+func (a *app) SetStaleMatchGrace(d time.Duration) {
+	s := a.Settings()
+	s.StaleMatchGrace = d
+	a.ApplySettings(s)
+}
+
+// SetRedactor hides the secrets known to r in the errors shown by /readyz and
+// /status.
+func (a *app) SetRedactor(r *helper.Redactor) {
+	a.redactor = r
+}
+
+// SetLeader makes the app poll and send only while l reports it is the
+// leader. Without one the app always runs.
+func (a *app) SetLeader(l Leader) {
+	a.leader = l
+}
+
+func (a *app) isLeader() bool {
+	return a.leader == nil || a.leader.IsLeader()
+}
+
+// SetSharder makes the app process only the matches s assigns to it. Without
+// one the app processes every match.
+func (a *app) SetSharder(s Sharder) {
+	a.sharder = s
+}
+
+func (a *app) owns(matchID string) bool {
+	return a.sharder == nil || a.sharder.Owns(matchID)
+}
+
+func (a *app) loadMatches(ctx context.Context) {
 	matches, err := a.db.GetAllMatches(ctx)
 	if err != nil {
 		slog.Error("failed to get matches from database", "error", err)
-	} else {
-		a.matchMutex.Lock()
-		for _, m := range matches {
-			a.matches[m.MatchId] = m
-		}
-		a.matchMutex.Unlock()
+		return
 	}
+	now := a.now()
+	a.matchMutex.Lock()
+	a.matches = map[string]models.Match{}
+	a.lastSeenLive = map[string]time.Time{}
+	for _, m := range matches {
+		a.matches[m.MatchId] = m
+		a.lastSeenLive[m.MatchId] = now
+	}
+	a.matchMutex.Unlock()
+}
+
+func (a *app) Run(ctx context.Context) error {
+	wasLeader := false
 	slog.Debug("starting app loop")
 	for {
+		// A poll in progress is finished on shutdown rather than cut short
+		pollCtx := context.Background()
+		if !a.isLeader() {
+			if wasLeader {
+				slog.Info("lost leadership, standing by")
+			}
+			wasLeader = false
+			slog.Debug("not the leader, skipping poll")
+		} else {
+			if !wasLeader {
+				// Another instance may have been tracking matches while we
+				// stood by, so start from what is in the database
+				a.loadMatches(pollCtx)
+				wasLeader = true
+			}
+			a.poll(pollCtx)
+		}
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
-			ctx := context.Background()
-			slog.Debug("getting matches")
-			err := a.getMatches(ctx)
-			if err != nil {
-				slog.Error("failed to get matches", "error", err)
-			}
-			slog.Debug("getting events")
-			err = a.monitorEvents(ctx)
-			if err != nil {
-				slog.Error("failed to update events", "error", err)
-			}
-			time.Sleep(a.sleepTimeSeconds * time.Second)
+		case <-time.After(a.settings().PollInterval):
 		}
 	}
 }
 
+// poll runs one cycle: find live matches, retire stale ones and process the
+// events of every tracked match.
+func (a *app) poll(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "poll")
+	defer span.End()
+	slog.Debug("getting matches")
+	err := a.getMatches(ctx)
+	a.health.recordPoll(a.now(), err)
+	if err != nil {
+		slog.Error("failed to get matches", "error", err)
+		a.failSpan(span, err)
+	} else {
+		// Only reap after a good poll, so a FIFA outage does not retire
+		// every match
+		a.reapStaleMatches(ctx)
+	}
+	slog.Debug("getting events")
+	err = a.monitorEvents(ctx)
+	if err != nil {
+		slog.Error("failed to update events", "error", err)
+		a.failSpan(span, err)
+	}
+	a.matchMutex.Lock()
+	metrics.TrackedMatches.Set(float64(len(a.matches)))
+	a.matchMutex.Unlock()
+}
+
 func (a *app) getMatches(ctx context.Context) error {
 	slog.Debug("getting matches from FIFA")
-	matches, err := fifa.GetLiveMatches(ctx, a.fifa)
+	start := time.Now()
+	fifaCtx, span := tracer.Start(ctx, "fifa.GetLiveMatches", trace.WithSpanKind(trace.SpanKindClient))
+	matches, err := fifa.GetLiveMatches(fifaCtx, a.fifa)
+	span.SetAttributes(attribute.Int("fifa.live_matches", len(matches)))
+	a.endSpan(span, err)
+	metrics.ObserveFIFARequest("live_matches", start, err)
 	if err != nil {
+		a.captureError(componentFIFA, "live_matches", nil, err)
 		return fmt.Errorf("failed to get live matches from FIFA. %w", err)
 	}
+	if err := a.loadControls(ctx); err != nil {
+		return err
+	}
+	now := a.now()
+	settings := a.settings()
+	live := map[string]bool{}
 	for _, m := range matches {
-		if len(a.CompetitionId) > 0 && m.CompetitionId != a.CompetitionId {
+		live[m.MatchId] = true
+		if !settings.watches(m.CompetitionId) {
 			continue
 		}
-		if _, exists := a.matches[m.MatchId]; exists {
+		if a.hasControl(models.ControlUntracked, m.MatchId) {
+			slog.Debug("match untracked by admin, not adding", "matchID", m.MatchId)
+			continue
+		}
+		if !a.owns(m.MatchId) {
+			continue
+		}
+		// Only matches this instance tracks are recorded, as nothing would
+		// ever forget the others
+		a.matchMutex.Lock()
+		a.lastSeenLive[m.MatchId] = now
+		_, exists := a.matches[m.MatchId]
+		a.matchMutex.Unlock()
+		if exists {
 			slog.Debug("match already exists in db, no need to add", "matchID", m.MatchId)
 			continue
 		}
+		if a.sharder != nil {
+			// Another worker may have owned this match before a rebalance, so
+			// carry on from the events it already claimed
+			stored, err := a.db.GetMatch(ctx, m.MatchId)
+			if err == nil {
+				slog.Debug("taking over match from database", "matchID", m.MatchId)
+				a.matchMutex.Lock()
+				a.matches[m.MatchId] = stored
+				a.matchMutex.Unlock()
+				continue
+			}
+			if !errors.Is(err, database.ErrMatchNotFound) {
+				a.captureError(componentStorage, "get_match", &m, err)
+				return fmt.Errorf("failed to get match %s from database. %w", m.MatchId, err)
+			}
+		}
 		slog.Debug("adding match to database", "matchID", m.MatchId, "competitionId", m.CompetitionId, "seasonId", m.SeasonId, "stageId", m.StageId, "homeTeam", m.HomeTeamName, "awayTeam", m.AwayTeamName)
 		err = a.db.AddMatch(ctx, m)
 		if err != nil {
+			a.captureError(componentStorage, "add_match", &m, err)
 			return fmt.Errorf("failed to add match %s to database. %w", m.MatchId, err)
 		}
+		a.matchMutex.Lock()
 		a.matches[m.MatchId] = m
+		a.matchMutex.Unlock()
 	}
-	return nil
+	return a.applyControls(ctx, live)
 }
 
 func (a *app) monitorEvents(ctx context.Context) error {
 	slog.Debug("starting event monitor")
-	g, ctx := errgroup.WithContext(ctx)
+	// Matches fail on their own, such as when one tenant's webhook is down,
+	// so one error must not cancel the others
+	var g errgroup.Group
+	a.matchMutex.Lock()
+	matches := make([]models.Match, 0, len(a.matches))
 	for _, match := range a.matches {
+		matches = append(matches, match)
+	}
+	a.matchMutex.Unlock()
+	for _, match := range matches {
 		g.Go(func() error {
-			return a.processMatch(ctx, &match)
+			err := a.processMatch(ctx, &match)
+			if a.tracking(match.MatchId) {
+				a.health.recordMatch(match.MatchId, a.now(), err)
+			}
+			return err
 		})
 	}
 	err := g.Wait()
@@ -122,21 +295,40 @@ func (a *app) monitorEvents(ctx context.Context) error {
 	return nil
 }
 
-func (a *app) processMatch(ctx context.Context, match *models.Match) error {
+func (a *app) processMatch(ctx context.Context, match *models.Match) (err error) {
+	ctx, span := tracer.Start(ctx, "processMatch", trace.WithAttributes(matchAttributes(match)...))
+	defer func() { a.endSpan(span, err) }()
+	if !a.isLeader() {
+		slog.Debug("lost leadership, not processing match", "matchId", match.MatchId)
+		return nil
+	}
+	if !a.owns(match.MatchId) {
+		// The owning worker picks it up from the database
+		slog.Debug("match moved to another worker", "matchId", match.MatchId)
+		a.forgetMatch(match.MatchId)
+		return nil
+	}
 	slog.Debug("getting match", "matchId", match.MatchId)
-	matchData, err := fifa.GetMatchEvents(ctx, a.fifa, match)
+	start := time.Now()
+	fifaCtx, fifaSpan := tracer.Start(ctx, "fifa.GetMatchEvents", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(matchAttributes(match)...))
+	matchData, err := fifa.GetMatchEvents(fifaCtx, a.fifa, match)
+	a.endSpan(fifaSpan, err)
+	metrics.ObserveFIFARequest("timeline", start, err)
 	if err != nil {
+		a.captureError(componentFIFA, "timeline", match, err)
 		return fmt.Errorf("failed to get match %s events from FIFA. %w", match.MatchId, err)
 	}
 	ids, messages := a.findNewEvents(ctx, match.Events, matchData.NewEvents, match)
-	existingEvents := match.Events
-	allEvents := append(existingEvents, ids...)
-	if len(allEvents) > len(existingEvents) {
-		match.Events = allEvents
-		err = a.db.UpdateMatch(ctx, *match)
-		if err != nil {
-			return fmt.Errorf("failed to save match %s events to the database. %w", match.MatchId, err)
-		}
+	span.SetAttributes(attribute.Int("match.new_events", len(ids)), attribute.Int("match.messages", len(messages)))
+	// Saved on every poll, even without new events, so that a quiet match
+	// does not expire from storage while it is still being played
+	match.Events = append(match.Events, ids...)
+	err = a.db.UpdateMatch(ctx, *match)
+	if err != nil {
+		a.captureError(componentStorage, "update_match", match, err)
+		return fmt.Errorf("failed to save match %s events to the database. %w", match.MatchId, err)
+	}
+	if len(ids) > 0 {
 		a.matchMutex.Lock()
 		a.matches[match.MatchId] = *match
 		a.matchMutex.Unlock()
@@ -145,7 +337,7 @@ func (a *app) processMatch(ctx context.Context, match *models.Match) error {
 	if len(messages) > 0 {
 		slog.Debug("sending messages for match", "matchId", match.MatchId)
 	}
-	err = a.sendEventsToSlack(ctx, messages)
+	err = a.sendEventsToSlack(ctx, match.MatchId, messages)
 	if err != nil {
 		slog.Error("failed to send message to slack", "error", err)
 		return fmt.Errorf("failed to send events to Slack. %w", err)
@@ -156,90 +348,307 @@ func (a *app) processMatch(ctx context.Context, match *models.Match) error {
 	slog.Debug("match is done", "matchId", match.MatchId)
 	err = a.db.DeleteMatch(ctx, match.MatchId)
 	if err != nil {
+		a.captureError(componentStorage, "delete_match", match, err)
 		return fmt.Errorf("failed to delete match %s. %w", match.MatchId, err)
 	}
+	a.forgetMatch(match.MatchId)
+	a.clearMatchControls(ctx, match.MatchId)
+	return nil
+}
+
+// tracking reports whether the match is still being polled.
+func (a *app) tracking(matchID string) bool {
 	a.matchMutex.Lock()
-	delete(a.matches, match.MatchId)
+	defer a.matchMutex.Unlock()
+	_, exists := a.matches[matchID]
+	return exists
+}
+
+func (a *app) forgetMatch(matchID string) {
+	a.matchMutex.Lock()
+	delete(a.matches, matchID)
+	delete(a.lastSeenLive, matchID)
+	delete(a.breadcrumbs, matchID)
 	a.matchMutex.Unlock()
-	return nil
+	a.health.forgetMatch(matchID)
 }
 
-func (a *app) sendEventsToSlack(ctx context.Context, events []string) error {
-	for _, evt := range events {
-		if strings.TrimSpace(evt) == "" {
+// reapStaleMatches retires tracked matches that FIFA has not listed as live
+// for longer than the grace period. This catches matches whose end event never
+// arrives, which would otherwise be polled until restart.
+func (a *app) reapStaleMatches(ctx context.Context) {
+	type staleMatch struct {
+		match      models.Match
+		missingFor time.Duration
+	}
+	now := a.now()
+	grace := a.settings().StaleMatchGrace
+	a.matchMutex.Lock()
+	stale := []staleMatch{}
+	for id, match := range a.matches {
+		if a.controls.Has(models.ControlForced, id) {
 			continue
 		}
-		slog.Debug("sending message to slack", "message", evt)
-		payload := models.SlackMessage{Text: evt}
-		b, err := json.Marshal(payload)
-		if err != nil {
-			return err
+		seen, exists := a.lastSeenLive[id]
+		if !exists {
+			a.lastSeenLive[id] = now
+			continue
 		}
-		resp, err := http.Post(a.slackWebhookURL, "application/json", bytes.NewReader(b))
-		if err != nil {
-			return err
+		if missingFor := now.Sub(seen); missingFor > grace {
+			stale = append(stale, staleMatch{match, missingFor})
 		}
-		if resp.StatusCode != http.StatusOK {
-			return errors.New(resp.Status)
+	}
+	a.matchMutex.Unlock()
+	for _, s := range stale {
+		a.retireMatch(ctx, s.match, s.missingFor)
+	}
+}
+
+func (a *app) retireMatch(ctx context.Context, match models.Match, missingFor time.Duration) {
+	slog.Warn("retiring match no longer reported live", "matchId", match.MatchId, "homeTeam", match.HomeTeamAbbrev, "awayTeam", match.AwayTeamAbbrev, "missingFor", missingFor.Round(time.Second).String())
+	if err := a.db.DeleteMatch(ctx, match.MatchId); err != nil {
+		// Keep tracking it so the next poll tries again
+		slog.Error("failed to delete stale match", "matchId", match.MatchId, "error", err)
+		a.captureError(componentStorage, "delete_match", &match, err)
+		return
+	}
+	// Captured before forgetting the match, which drops its breadcrumbs
+	a.captureRetiredMatch(match, missingFor.String())
+	a.forgetMatch(match.MatchId)
+	a.clearMatchControls(ctx, match.MatchId)
+}
+
+// claimEvent marks the event as processed in the database, returning false if
+// it was already claimed, possibly by another instance. A match that has expired
+// from the database is saved again first.
+func (a *app) claimEvent(ctx context.Context, match *models.Match, eventID string) (bool, error) {
+	claimed, err := a.db.ClaimEvent(ctx, match.MatchId, eventID)
+	if !errors.Is(err, database.ErrMatchNotFound) {
+		return claimed, err
+	}
+	slog.Warn("match missing from database, adding it again", "matchId", match.MatchId)
+	if err := a.db.AddMatch(ctx, *match); err != nil {
+		return false, fmt.Errorf("failed to add match %s to database. %w", match.MatchId, err)
+	}
+	return a.db.ClaimEvent(ctx, match.MatchId, eventID)
+}
+
+// message is a rendered event waiting to be sent.
+type message struct {
+	eventID   string
+	eventType string
+	text      string
+	// timestamp is when FIFA says the event happened
+	timestamp time.Time
+	// tenants receive the message
+	tenants []Tenant
+	// tenantTexts replace text for the tenants, by name, that render the
+	// event type with their own custom event
+	tenantTexts map[string]string
+}
+
+// textFor returns the text sent to a tenant.
+func (m message) textFor(tenant Tenant) string {
+	if text, ok := m.tenantTexts[tenant.Name]; ok {
+		return text
+	}
+	return m.text
+}
+
+// sendEventsToSlack sends each message to its tenants. A tenant that fails is
+// sent nothing more from this batch, so its messages stay in order, and the
+// other tenants carry on.
+func (a *app) sendEventsToSlack(ctx context.Context, matchID string, events []message) error {
+	failed := map[string]bool{}
+	var errs []error
+	for _, evt := range events {
+		if a.notificationsPaused(matchID) {
+			slog.Info("notifications paused, not sending event", "matchId", matchID, "eventId", evt.eventID)
+			continue
+		}
+		for _, tenant := range evt.tenants {
+			if failed[tenant.Name] || strings.TrimSpace(evt.textFor(tenant)) == "" {
+				continue
+			}
+			if err := a.notify(ctx, tenant, matchID, evt); err != nil {
+				failed[tenant.Name] = true
+				if tenant.Name != "" {
+					err = fmt.Errorf("failed to notify tenant %s. %w", tenant.Name, err)
+				}
+				errs = append(errs, err)
+			}
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// notify sends one message to one tenant and records the outcome.
+func (a *app) notify(ctx context.Context, tenant Tenant, matchID string, evt message) error {
+	destination := a.destination(tenant)
+	text := evt.textFor(tenant)
+	slog.Debug("sending message", "destination", destination, "message", text)
+	_, span := tracer.Start(ctx, "notify."+destinationKind(destination), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(eventAttributes(evt)...))
+	span.SetAttributes(attribute.String("match.id", matchID), attribute.String("notify.destination", destination))
+	if tenant.Name != "" {
+		span.SetAttributes(attribute.String("tenant", tenant.Name))
+	}
+	if !evt.timestamp.IsZero() {
+		span.SetAttributes(attribute.String("event.timestamp", evt.timestamp.Format(time.RFC3339)))
+	}
+	start := time.Now()
+	err := a.deliver(tenant, matchID, evt.eventID, text)
+	a.endSpan(span, err)
+	metrics.ObserveNotification(destination, start, err)
+	a.health.recordNotification(a.now(), err)
+	a.recordNotification(ctx, matchID, evt.eventID, destination, err)
+	if err != nil {
+		a.matchMutex.Lock()
+		match, tracked := a.matches[matchID]
+		a.matchMutex.Unlock()
+		if !tracked {
+			match = models.Match{MatchId: matchID}
+		}
+		a.captureError(componentNotifier, destination, &match, err)
+		return err
+	}
+	metrics.EventsTotal.WithLabelValues(evt.eventType, metrics.EventPosted).Inc()
+	if !evt.timestamp.IsZero() {
+		metrics.EventPostDelay.Observe(time.Since(evt.timestamp).Seconds())
+	}
 	return nil
 }
 
-func (a *app) findNewEvents(ctx context.Context, existingEvents []string, newEvents []go_fifa.TimelineEvent, opts *models.Match) ([]string, []string) {
-	eventMsgs := []string{}
+// PostToSlack sends text to a Slack incoming webhook.
+func PostToSlack(webhookURL string, text string) error {
+	payload := models.SlackMessage{Text: text}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// recordEvent stores what was processed for the event alongside the match.
+// Failures are logged and do not stop the event being sent.
+func (a *app) recordEvent(ctx context.Context, match *models.Match, evt go_fifa.TimelineEvent, result fifa.ProcessEventResult) {
+	err := a.db.RecordEvent(ctx, match.MatchId, fifa.NewEventRecord(evt, result))
+	if err != nil {
+		slog.Error("failed to record event history", "matchId", match.MatchId, "eventId", evt.Id, "error", err)
+		a.captureError(componentStorage, "record_event", match, err)
+	}
+}
+
+func (a *app) recordNotification(ctx context.Context, matchID string, eventID string, destination string, sendErr error) {
+	history, ok := a.db.(database.History)
+	if !ok {
+		return
+	}
+	if sendErr != nil {
+		// History is kept for good, so it must not keep a webhook URL
+		sendErr = errors.New(a.redactor.Redact(sendErr.Error()))
+	}
+	err := history.RecordNotification(ctx, matchID, eventID, destination, sendErr)
+	if err != nil {
+		slog.Error("failed to record notification history", "matchId", matchID, "eventId", eventID, "error", err)
+	}
+}
+
+func (a *app) findNewEvents(ctx context.Context, existingEvents []string, newEvents []go_fifa.TimelineEvent, opts *models.Match) ([]string, []message) {
+	eventMsgs := []message{}
 	eventIds := []string{}
+	settings := a.settings()
+	// Events every tenant skips are not rendered, the others are rendered once
+	// and sent to each tenant that wants them
+	eventsToSkip := settings.skippedByAll(opts.CompetitionId)
+	seen := make(map[string]bool, len(existingEvents))
+	for _, id := range existingEvents {
+		seen[id] = true
+	}
 
 	for _, event := range newEvents {
-		eventFound := slices.Contains(existingEvents, event.Id)
-		if eventFound {
+		if seen[event.Id] {
+			continue
+		}
+		claimed, err := a.claimEvent(ctx, opts, event.Id)
+		if err != nil {
+			// Leave the rest for the next poll rather than risk announcing twice
+			slog.Error("failed to claim event", "matchId", opts.MatchId, "eventId", event.Id, "error", err)
+			a.captureError(componentStorage, "claim_event", opts, err)
+			break
+		}
+		if !claimed {
+			slog.Debug("event already claimed", "matchId", opts.MatchId, "eventId", event.Id)
+			eventIds = append(eventIds, event.Id)
 			continue
 		}
-		result := fifa.ProcessEvent(ctx, event, opts, a.eventsToSkip)
+		eventType := settings.CustomEvents.Name(event.Type)
+		metrics.EventsTotal.WithLabelValues(eventType, metrics.EventSeen).Inc()
+		// Rendering keeps the shootout tallies on the match, so each tenant
+		// renders a copy of it as it was before this event
+		before := *opts
+		result := settings.CustomEvents.ProcessEvent(ctx, event, opts, eventsToSkip)
+		recipients := settings.recipients(opts.CompetitionId, event.Type)
+		if len(recipients) == 0 {
+			// No tenant follows the competition, such as for a match tracked
+			// through the admin API
+			result.SlackMessage = ""
+		}
+		var tenantTexts map[string]string
+		tenantHasText := false
+		for _, tenant := range recipients {
+			match := before
+			if text, ok := tenant.render(ctx, event, &match, settings.CustomEvents); ok {
+				if tenantTexts == nil {
+					tenantTexts = map[string]string{}
+				}
+				tenantTexts[tenant.Name] = text
+				tenantHasText = tenantHasText || strings.TrimSpace(text) != ""
+			}
+		}
+		if result.IsUnknown && len(tenantTexts) > 0 {
+			// Only the tenants that map the type are sent it
+			result = fifa.ProcessEventResult{}
+		}
+		a.recordEvent(ctx, opts, event, result)
 
-		// Unknown event types are captured to Sentry instead of sent to Slack
+		// Unknown event types are quarantined and captured to Sentry instead
+		// of sent to Slack
 		if result.IsUnknown {
+			metrics.EventsTotal.WithLabelValues(eventType, metrics.EventUnknown).Inc()
 			slog.Warn("unknown event type detected", "eventId", event.Id, "eventType", event.Type, "matchId", opts.MatchId)
+			a.quarantineEvent(ctx, opts, event)
 			if a.sentryEnabled {
 				a.captureUnknownEvent(event, opts)
 			}
+			a.addBreadcrumb(opts, event, metrics.EventUnknown)
 			eventIds = append(eventIds, event.Id)
 			continue
 		}
 
-		slog.Debug("found new event", "eventId", event.Id, "message", result.SlackMessage)
 		eventIds = append(eventIds, event.Id)
-		eventMsgs = append(eventMsgs, result.SlackMessage)
+		if strings.TrimSpace(result.SlackMessage) == "" && !tenantHasText {
+			metrics.EventsTotal.WithLabelValues(eventType, metrics.EventSkipped).Inc()
+			a.addBreadcrumb(opts, event, metrics.EventSkipped)
+			continue
+		}
+		a.addBreadcrumb(opts, event, "rendered")
+		slog.Debug("found new event", "eventId", event.Id, "message", result.SlackMessage)
+		eventMsgs = append(eventMsgs, message{
+			eventID:     event.Id,
+			eventType:   eventType,
+			text:        result.SlackMessage,
+			timestamp:   event.Timestamp,
+			tenants:     recipients,
+			tenantTexts: tenantTexts,
+		})
 	}
 	return eventIds, eventMsgs
 }
-
-func (a *app) captureUnknownEvent(evt go_fifa.TimelineEvent, match *models.Match) {
-	eventJSON, err := json.Marshal(evt)
-	if err != nil {
-		slog.Error("failed to marshal unknown event to JSON", "error", err)
-		return
-	}
-
-	matchJSON, err := json.Marshal(match)
-	if err != nil {
-		slog.Error("failed to marshal match info to JSON", "error", err)
-		return
-	}
-
-	sentry.WithScope(func(scope *sentry.Scope) {
-		scope.SetTags(map[string]string{
-			"event_type":     fmt.Sprintf("%d", evt.Type),
-			"match_id":       match.MatchId,
-			"stage_id":       match.StageId,
-			"season_id":      match.SeasonId,
-			"competition_id": match.CompetitionId,
-			"home_team":      match.HomeTeamAbbrev,
-			"away_team":      match.AwayTeamAbbrev,
-		})
-		scope.SetExtra("full_event_json", string(eventJSON))
-		scope.SetExtra("match_info_json", string(matchJSON))
-		sentry.CaptureMessage(fmt.Sprintf("Unknown event type: %d in match %s (%s vs %s)",
-			evt.Type, match.MatchId, match.HomeTeamAbbrev, match.AwayTeamAbbrev))
-	})
-}
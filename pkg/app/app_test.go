@@ -0,0 +1,1213 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/getsentry/sentry-go"
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/fifa"
+	"github.com/imdevinc/fifa-bot/pkg/fifa/fifatest"
+	"github.com/imdevinc/fifa-bot/pkg/helper"
+	"github.com/imdevinc/fifa-bot/pkg/metrics"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeSlack struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	messages []string
+	// status, if set, is returned instead of accepting messages
+	status atomic.Int32
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	s := &fakeSlack{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := s.status.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			return
+		}
+		var msg models.SlackMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg.Text)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// take returns the messages received since the last call.
+func (s *fakeSlack) take() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.messages
+	s.messages = nil
+	return msgs
+}
+
+func description(text string) []go_fifa.LocaleDescription {
+	return []go_fifa.LocaleDescription{{Locale: "en-GB", Description: text}}
+}
+
+// testEnv is the fake FIFA, fake Slack and storage shared by the apps of a
+// test.
+type testEnv struct {
+	fifa  *fifatest.Server
+	slack *fakeSlack
+	db    database.Database
+}
+
+// newTestApp returns an app that polls a fake FIFA with no matches yet and
+// posts to a fake Slack, changed by opts.
+func newTestApp(t *testing.T, opts ...func(*app)) (*app, *testEnv) {
+	fifaServer := fifatest.NewServer()
+	t.Cleanup(fifaServer.Close)
+	env := &testEnv{fifa: fifaServer, slack: newFakeSlack(t), db: database.NewMemoryClient()}
+	return env.newApp(opts...), env
+}
+
+// newApp returns another app on the env's FIFA, Slack and storage.
+func (e *testEnv) newApp(opts ...func(*app)) *app {
+	a := New(e.db, e.fifa.Client(), e.slack.server.URL, "", 60, nil, false)
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// withSettings changes the settings an app starts with.
+func withSettings(change func(*Settings)) func(*app) {
+	return func(a *app) {
+		s := a.Settings()
+		change(&s)
+		a.ApplySettings(s)
+	}
+}
+
+// testMatch returns a match of competition 17 between the USA and Mexico.
+func testMatch(id string) models.Match {
+	return models.Match{CompetitionId: "17", SeasonId: "1", StageId: "2", MatchId: id, HomeTeamAbbrev: "USA", AwayTeamAbbrev: "MEX"}
+}
+
+func TestAppAgainstFakeFIFA(t *testing.T) {
+	ctx := context.Background()
+	a, env := newTestApp(t, withSettings(func(s *Settings) { s.CompetitionID = "17" }))
+	fifaServer, slack, db := env.fifa, env.slack, env.db
+
+	match := models.Match{
+		CompetitionId:  "17",
+		SeasonId:       "285023",
+		StageId:        "289287",
+		MatchId:        "400021528",
+		HomeTeamID:     "43922",
+		AwayTeamID:     "43855",
+		HomeTeamName:   "Argentina",
+		AwayTeamName:   "Egypt",
+		HomeTeamAbbrev: "ARG",
+		AwayTeamAbbrev: "EGY",
+	}
+	fifaServer.AddMatch(match)
+
+	poll := func() []string {
+		t.Helper()
+		require.NoError(t, a.getMatches(ctx))
+		require.NoError(t, a.monitorEvents(ctx))
+		return slack.take()
+	}
+
+	_, err := fifaServer.PushEvent(match.MatchId, go_fifa.TimelineEvent{
+		Type:        go_fifa.MatchStart,
+		Period:      go_fifa.FirstPeriod,
+		MatchMinute: "0'",
+		Description: description("Kick off"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0' :clock12: Kick off Argentina :flag-ar: vs :flag-eg: Egypt"}, poll())
+	_, err = db.GetMatch(ctx, match.MatchId)
+	assert.NoError(t, err)
+
+	// Nothing new means nothing is posted again
+	assert.Empty(t, poll())
+
+	goalID, err := fifaServer.PushEvent(match.MatchId, go_fifa.TimelineEvent{
+		Type:        go_fifa.GoalScore,
+		Period:      go_fifa.FirstPeriod,
+		TeamId:      match.HomeTeamID,
+		MatchMinute: "12'",
+		HomeGoals:   1,
+		Description: description("Player one scores!"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, fifaServer.SetPending(match.MatchId, goalID, true))
+	assert.Empty(t, poll(), "pending events must not be announced")
+
+	require.NoError(t, fifaServer.SetPending(match.MatchId, goalID, false))
+	assert.Equal(t, []string{"12' :soccer: Player one scores! 1 ARG :flag-ar: : :flag-eg: EGY 0"}, poll())
+
+	cardID, err := fifaServer.PushEvent(match.MatchId, go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		Period:      go_fifa.FirstPeriod,
+		TeamId:      match.AwayTeamID,
+		MatchMinute: "30'",
+		HomeGoals:   1,
+		Description: description("Player two is booked"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, fifaServer.DeleteEvent(match.MatchId, cardID))
+	assert.Empty(t, poll(), "deleted events must not be announced")
+
+	_, err = fifaServer.EndMatch(match.MatchId)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"12' :clock12: 1 ARG :flag-ar: : :flag-eg: EGY 0"}, poll())
+	assert.NotContains(t, a.matches, match.MatchId)
+	_, err = db.GetMatch(ctx, match.MatchId)
+	assert.ErrorIs(t, err, database.ErrMatchNotFound)
+
+	assert.Empty(t, poll())
+}
+
+func TestAppIgnoresOtherCompetitions(t *testing.T) {
+	ctx := context.Background()
+	a, env := newTestApp(t, withSettings(func(s *Settings) { s.CompetitionID = "17" }))
+
+	match := testMatch("3")
+	match.CompetitionId = "2000"
+	env.fifa.AddMatch(match)
+	_, err := env.fifa.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.MatchStart,
+		Description: description("Kick off"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.getMatches(ctx))
+	require.NoError(t, a.monitorEvents(ctx))
+	assert.Empty(t, a.matches)
+	assert.Empty(t, env.slack.take())
+}
+
+func TestAppInstancesSharingDatabaseAnnounceOnce(t *testing.T) {
+	ctx := context.Background()
+	first, env := newTestApp(t)
+	second := env.newApp()
+	fifaServer, slack, db := env.fifa, env.slack, env.db
+
+	fifaServer.AddMatch(testMatch("3"))
+	require.NoError(t, first.getMatches(ctx))
+	require.NoError(t, second.getMatches(ctx))
+
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: description("Player one is booked"),
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, a := range []*app{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, a.monitorEvents(ctx))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"5' :large_yellow_square: Player one is booked"}, slack.take())
+
+	records, err := db.GetEventRecords(ctx, "3")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int(go_fifa.YellowCard), records[0].Type)
+	assert.Equal(t, "5'", records[0].Minute)
+	assert.Equal(t, "Player one is booked", records[0].Description)
+	assert.Equal(t, "5' :large_yellow_square: Player one is booked", records[0].Message)
+}
+
+type fakeLeader struct {
+	leader atomic.Bool
+}
+
+func (l *fakeLeader) IsLeader() bool {
+	return l.leader.Load()
+}
+
+func TestAppStandbyDoesNotAnnounce(t *testing.T) {
+	ctx := context.Background()
+	lease := &fakeLeader{}
+	a, env := newTestApp(t, func(a *app) { a.SetLeader(lease) })
+	slack := env.slack
+
+	env.fifa.AddMatch(testMatch("3"))
+	require.NoError(t, a.getMatches(ctx))
+
+	_, err := env.fifa.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: description("Player one is booked"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.monitorEvents(ctx))
+	assert.Empty(t, slack.take())
+
+	lease.leader.Store(true)
+	require.NoError(t, a.monitorEvents(ctx))
+	assert.Equal(t, []string{"5' :large_yellow_square: Player one is booked"}, slack.take())
+}
+
+func TestAppRunStopsWhileWaiting(t *testing.T) {
+	a, env := newTestApp(t, withSettings(func(s *Settings) { s.PollInterval = time.Hour }))
+	env.fifa.AddMatch(testMatch("3"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- a.Run(ctx) }()
+	require.Eventually(t, func() bool { return a.tracking("3") }, time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+}
+
+type fakeSharder struct {
+	mu    sync.Mutex
+	owned map[string]bool
+}
+
+func (s *fakeSharder) Owns(matchID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owned[matchID]
+}
+
+func (s *fakeSharder) set(owned ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.owned = map[string]bool{}
+	for _, id := range owned {
+		s.owned[id] = true
+	}
+}
+
+func TestAppShardedWorkersSplitMatches(t *testing.T) {
+	ctx := context.Background()
+	firstShard, secondShard := &fakeSharder{}, &fakeSharder{}
+	firstShard.set("3")
+	secondShard.set("4")
+	first, env := newTestApp(t, func(a *app) { a.SetSharder(firstShard) })
+	second := env.newApp(func(a *app) { a.SetSharder(secondShard) })
+	fifaServer, slack := env.fifa, env.slack
+
+	for _, id := range []string{"3", "4"} {
+		fifaServer.AddMatch(testMatch(id))
+	}
+
+	require.NoError(t, first.getMatches(ctx))
+	require.NoError(t, second.getMatches(ctx))
+	assert.Len(t, first.matches, 1)
+	assert.Contains(t, first.matches, "3")
+	assert.NotContains(t, first.lastSeenLive, "4", "matches of other workers are not recorded")
+	assert.Len(t, second.matches, 1)
+	assert.Contains(t, second.matches, "4")
+
+	_, err := fifaServer.PushEvent("4", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: description("Player one is booked"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, first.monitorEvents(ctx))
+	assert.Empty(t, slack.take())
+	require.NoError(t, second.monitorEvents(ctx))
+	assert.Equal(t, []string{"5' :large_yellow_square: Player one is booked"}, slack.take())
+
+	// The second worker leaves and the first takes over its match without
+	// announcing the card again
+	secondShard.set()
+	firstShard.set("3", "4")
+	require.NoError(t, second.monitorEvents(ctx))
+	assert.Empty(t, second.matches)
+	require.NoError(t, first.getMatches(ctx))
+	assert.Equal(t, []string{"1"}, first.matches["4"].Events)
+
+	_, err = fifaServer.PushEvent("4", go_fifa.TimelineEvent{
+		Type:        go_fifa.RedCard,
+		MatchMinute: "10'",
+		Description: description("Player two is sent off"),
+	})
+	require.NoError(t, err)
+	require.NoError(t, first.monitorEvents(ctx))
+	assert.Equal(t, []string{"10' :large_red_square: Player two is sent off"}, slack.take())
+}
+
+func TestAppRetiresStaleMatches(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	a, env := newTestApp(t, func(a *app) {
+		a.now = func() time.Time { return now }
+		a.SetStaleMatchGrace(10 * time.Minute)
+	})
+	fifaServer, db := env.fifa, env.db
+
+	for _, id := range []string{"3", "4"} {
+		fifaServer.AddMatch(testMatch(id))
+	}
+	require.NoError(t, a.getMatches(ctx))
+	require.Len(t, a.matches, 2)
+
+	// FIFA stops listing match 4 without ever sending its end
+	require.NoError(t, fifaServer.DropMatch("4"))
+	now = now.Add(10 * time.Minute)
+	require.NoError(t, a.getMatches(ctx))
+	a.reapStaleMatches(ctx)
+	assert.Len(t, a.matches, 2, "the match is kept during the grace period")
+
+	now = now.Add(time.Minute)
+	require.NoError(t, a.getMatches(ctx))
+	a.reapStaleMatches(ctx)
+	assert.Len(t, a.matches, 1)
+	assert.Contains(t, a.matches, "3")
+	_, err := db.GetMatch(ctx, "4")
+	assert.ErrorIs(t, err, database.ErrMatchNotFound)
+	_, err = db.GetMatch(ctx, "3")
+	assert.NoError(t, err)
+}
+
+func TestAppKeepsQuietMatchesStored(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := database.NewRedisClient(mr.Addr(), "", 0, "")
+	db.SetMatchTTL(time.Hour)
+	a, env := newTestApp(t, func(a *app) { a.db = db })
+
+	env.fifa.AddMatch(testMatch("3"))
+	a.poll(ctx)
+	// Nothing happens for longer than the TTL, but every poll pushes the
+	// expiry back
+	for range 3 {
+		mr.FastForward(45 * time.Minute)
+		a.poll(ctx)
+	}
+	_, err := db.GetMatch(ctx, "3")
+	assert.NoError(t, err)
+}
+
+func getJSON(t *testing.T, handler http.Handler, path string, v any) int {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+	return rec.Code
+}
+
+func TestAppOpsEndpoints(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	a, env := newTestApp(t, func(a *app) { a.now = func() time.Time { return now } })
+	fifaServer, slack := env.fifa, env.slack
+
+	fifaServer.AddMatch(testMatch("3"))
+	handler := a.OpsHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var ready readyResponse
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, handler, "/readyz", &ready))
+	assert.Equal(t, "no successful poll yet", ready.Checks["fifa_poll"])
+
+	a.poll(ctx)
+	assert.Equal(t, http.StatusOK, getJSON(t, handler, "/readyz", &ready))
+	assert.Equal(t, map[string]string{"database": "ok", "fifa_poll": "ok", "notifier": "ok"}, ready.Checks)
+
+	var status statusResponse
+	assert.Equal(t, http.StatusOK, getJSON(t, handler, "/status", &status))
+	assert.True(t, status.Leader)
+	assert.True(t, now.Equal(status.LastPoll))
+	require.Len(t, status.Matches, 1)
+	assert.Equal(t, "3", status.Matches[0].MatchID)
+	assert.Equal(t, "USA", status.Matches[0].HomeTeam)
+	assert.True(t, now.Equal(status.Matches[0].LastPolled))
+	assert.Empty(t, status.Matches[0].LastError)
+
+	// Slack starts rejecting messages
+	slack.status.Store(http.StatusInternalServerError)
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: description("Player one is booked"),
+	})
+	require.NoError(t, err)
+	a.poll(ctx)
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, handler, "/readyz", &ready))
+	assert.Equal(t, "500 Internal Server Error", ready.Checks["notifier"])
+	getJSON(t, handler, "/status", &status)
+	assert.Contains(t, status.Matches[0].LastError, "500 Internal Server Error")
+
+	// The loop wedges and stops polling
+	slack.status.Store(0)
+	now = now.Add(a.maxPollAge() + time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, handler, "/readyz", &ready))
+	assert.Contains(t, ready.Checks["fifa_poll"], "last successful poll")
+	assert.Equal(t, "ok", ready.Checks["notifier"], "an old send failure no longer counts")
+}
+
+func delaySamples(t *testing.T) uint64 {
+	var m dto.Metric
+	require.NoError(t, metrics.EventPostDelay.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestAppMetrics(t *testing.T) {
+	ctx := context.Background()
+	a, env := newTestApp(t, withSettings(func(s *Settings) {
+		s.EventsToSkip = map[go_fifa.MatchEvent]bool{go_fifa.RedCard: true}
+	}))
+	fifaServer := env.fifa
+
+	fifaServer.AddMatch(testMatch("3"))
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Timestamp:   time.Now().Add(-10 * time.Second),
+		Description: description("Player one is booked"),
+	})
+	require.NoError(t, err)
+	_, err = fifaServer.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.RedCard,
+		MatchMinute: "6'",
+		Description: description("Player two is sent off"),
+	})
+	require.NoError(t, err)
+
+	count := func(eventType, outcome string) float64 {
+		return testutil.ToFloat64(metrics.EventsTotal.WithLabelValues(eventType, outcome))
+	}
+	seenBefore := count("YellowCard", metrics.EventSeen)
+	postedBefore := count("YellowCard", metrics.EventPosted)
+	skippedBefore := count("RedCard", metrics.EventSkipped)
+	delaysBefore := delaySamples(t)
+
+	a.poll(ctx)
+
+	assert.Equal(t, seenBefore+1, count("YellowCard", metrics.EventSeen))
+	assert.Equal(t, postedBefore+1, count("YellowCard", metrics.EventPosted))
+	assert.Equal(t, skippedBefore+1, count("RedCard", metrics.EventSkipped))
+	assert.Equal(t, delaysBefore+1, delaySamples(t), "only the posted event has a delay")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.TrackedMatches))
+
+	rec := httptest.NewRecorder()
+	a.OpsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	for _, name := range []string{
+		"fifa_bot_fifa_request_duration_seconds",
+		"fifa_bot_events_total",
+		"fifa_bot_notification_duration_seconds",
+		"fifa_bot_tracked_matches",
+		"fifa_bot_event_post_delay_seconds",
+	} {
+		assert.True(t, strings.Contains(body, name), "missing %s", name)
+	}
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == attribute.Key(key) {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// spanRecorders passes spans to the recorder of the running test. The app's
+// tracer sticks to the first provider set globally, so the provider is set
+// once and each test swaps in its own recorder.
+type spanRecorders struct {
+	mu       sync.Mutex
+	recorder *tracetest.SpanRecorder
+}
+
+var testSpans = &spanRecorders{}
+var setTestTracerProvider sync.Once
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	setTestTracerProvider.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(testSpans)))
+	})
+	recorder := tracetest.NewSpanRecorder()
+	testSpans.set(recorder)
+	t.Cleanup(func() { testSpans.set(nil) })
+	return recorder
+}
+
+func (s *spanRecorders) set(recorder *tracetest.SpanRecorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorder = recorder
+}
+
+func (s *spanRecorders) current() *tracetest.SpanRecorder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recorder
+}
+
+func (s *spanRecorders) OnStart(ctx context.Context, span sdktrace.ReadWriteSpan) {
+	if r := s.current(); r != nil {
+		r.OnStart(ctx, span)
+	}
+}
+
+func (s *spanRecorders) OnEnd(span sdktrace.ReadOnlySpan) {
+	if r := s.current(); r != nil {
+		r.OnEnd(span)
+	}
+}
+
+func (s *spanRecorders) Shutdown(context.Context) error   { return nil }
+func (s *spanRecorders) ForceFlush(context.Context) error { return nil }
+
+func TestAppTracing(t *testing.T) {
+	ctx := context.Background()
+	recorder := recordSpans(t)
+	a, env := newTestApp(t)
+
+	env.fifa.AddMatch(testMatch("3"))
+	eventID, err := env.fifa.PushEvent("3", go_fifa.TimelineEvent{
+		Type:        go_fifa.YellowCard,
+		MatchMinute: "5'",
+		Description: description("Player one is booked"),
+	})
+	require.NoError(t, err)
+
+	a.poll(ctx)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "poll")
+	require.Contains(t, spans, "fifa.GetLiveMatches")
+	require.Contains(t, spans, "processMatch")
+	require.Contains(t, spans, "fifa.GetMatchEvents")
+	require.Contains(t, spans, "notify.slack")
+
+	poll := spans["poll"].SpanContext().SpanID()
+	assert.Equal(t, poll, spans["fifa.GetLiveMatches"].Parent().SpanID())
+	assert.Equal(t, poll, spans["processMatch"].Parent().SpanID())
+	process := spans["processMatch"].SpanContext().SpanID()
+	assert.Equal(t, process, spans["fifa.GetMatchEvents"].Parent().SpanID())
+	assert.Equal(t, process, spans["notify.slack"].Parent().SpanID())
+
+	assert.Equal(t, "3", spanAttribute(spans["processMatch"], "match.id"))
+	assert.Equal(t, "USA", spanAttribute(spans["processMatch"], "match.home_team"))
+	assert.Equal(t, "3", spanAttribute(spans["notify.slack"], "match.id"))
+	assert.Equal(t, eventID, spanAttribute(spans["notify.slack"], "event.id"))
+	assert.Equal(t, "YellowCard", spanAttribute(spans["notify.slack"], "event.type"))
+}
+
+func adminRequest(handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAppAdminAPI(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	a, env := newTestApp(t, func(a *app) {
+		a.now = func() time.Time { return now }
+		a.SetAdminToken("secret")
+	})
+	fifaServer, slack, db := env.fifa, env.slack, env.db
+
+	for _, id := range []string{"3", "4"} {
+		fifaServer.AddMatch(testMatch(id))
+	}
+	// FIFA never lists match 4 as live
+	require.NoError(t, fifaServer.DropMatch("4"))
+
+	handler := a.OpsHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/matches", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	a.poll(ctx)
+	rec = adminRequest(handler, http.MethodPost, "/admin/matches", `{"competition_id":"17","season_id":"1","stage_id":"2","match_id":"4"}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = adminRequest(handler, http.MethodPost, "/admin/matches", `{"match_id":"5"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing competition_id, season_id, stage_id")
+	rec = adminRequest(handler, http.MethodPost, "/admin/matches", `{"competition_id":"17","season_id":"1","stage_id":"2","match_id":"5; DROP"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `not numeric FIFA IDs: match_id \"5; DROP\"`)
+
+	var matches []TrackedMatch
+	require.NoError(t, json.Unmarshal(adminRequest(handler, http.MethodGet, "/admin/matches", "").Body.Bytes(), &matches))
+	require.Len(t, matches, 2)
+	assert.Equal(t, "3", matches[0].MatchId)
+	assert.False(t, matches[0].Forced)
+	assert.Equal(t, "4", matches[1].MatchId)
+	assert.True(t, matches[1].Forced)
+	_, err := db.GetMatch(ctx, "4")
+	require.NoError(t, err)
+
+	first, err := fifaServer.PushEvent("4", go_fifa.TimelineEvent{Type: go_fifa.YellowCard, MatchMinute: "5'", Description: description("Player one is booked")})
+	require.NoError(t, err)
+	a.poll(ctx)
+	require.Len(t, slack.take(), 1)
+
+	// Paused events are processed but not sent
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/matches/4/pause", "").Code)
+	_, err = fifaServer.PushEvent("4", go_fifa.TimelineEvent{Type: go_fifa.YellowCard, MatchMinute: "6'", Description: description("Player two is booked")})
+	require.NoError(t, err)
+	a.poll(ctx)
+	assert.Empty(t, slack.take())
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/matches/4/resume", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/matches/4/events/"+first+"/resend", "").Code)
+	assert.Equal(t, []string{"5' :large_yellow_square: Player one is booked"}, slack.take())
+	assert.Equal(t, http.StatusNotFound, adminRequest(handler, http.MethodPost, "/admin/matches/4/events/nope/resend", "").Code)
+
+	// A reset announces the whole timeline again
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/matches/4/reset", "").Code)
+	a.poll(ctx)
+	assert.Len(t, slack.take(), 2)
+
+	// Forced matches are not retired, untracked ones are not picked up again
+	now = now.Add(2 * DefaultStaleMatchGrace)
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodDelete, "/admin/matches/3", "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(handler, http.MethodDelete, "/admin/matches/3", "").Code)
+	a.poll(ctx)
+	require.NoError(t, json.Unmarshal(adminRequest(handler, http.MethodGet, "/admin/matches", "").Body.Bytes(), &matches))
+	require.Len(t, matches, 1)
+	assert.Equal(t, "4", matches[0].MatchId)
+	_, err = db.GetMatch(ctx, "3")
+	assert.ErrorIs(t, err, database.ErrMatchNotFound)
+}
+
+func TestAppAdminControlsSharedThroughStorage(t *testing.T) {
+	ctx := context.Background()
+	admin, env := newTestApp(t, func(a *app) { a.SetAdminToken("secret") })
+	// worker stands for another instance, or this one after a restart
+	worker := env.newApp()
+	fifaServer, slack, db := env.fifa, env.slack, env.db
+
+	for _, id := range []string{"3", "4"} {
+		fifaServer.AddMatch(testMatch(id))
+	}
+	require.NoError(t, fifaServer.DropMatch("4"))
+	worker.poll(ctx)
+
+	handler := admin.OpsHandler()
+	rec := adminRequest(handler, http.MethodPost, "/admin/matches", `{"competition_id":"17","season_id":"1","stage_id":"2","match_id":"4"}`)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodDelete, "/admin/matches/3", "").Code)
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/pause", "").Code)
+
+	_, err := fifaServer.PushEvent("4", go_fifa.TimelineEvent{Type: go_fifa.YellowCard, MatchMinute: "5'", Description: description("Player one is booked")})
+	require.NoError(t, err)
+	worker.poll(ctx)
+	assert.True(t, worker.tracking("4"))
+	assert.False(t, worker.tracking("3"))
+	assert.Empty(t, slack.take())
+
+	// The reset waits for the worker's next poll
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/resume", "").Code)
+	assert.Equal(t, http.StatusNoContent, adminRequest(handler, http.MethodPost, "/admin/matches/4/reset", "").Code)
+	match, err := db.GetMatch(ctx, "4")
+	require.NoError(t, err)
+	assert.Len(t, match.Events, 1)
+	worker.poll(ctx)
+	assert.Equal(t, []string{"5' :large_yellow_square: Player one is booked"}, slack.take())
+	controls, err := db.GetControls(ctx)
+	require.NoError(t, err)
+	assert.False(t, controls.Has(models.ControlReset, "4"))
+}
+
+func TestAppDryRun(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	now := time.Date(2026, 6, 11, 19, 0, 0, 0, time.UTC)
+	a, env := newTestApp(t, func(a *app) {
+		a.now = func() time.Time { return now }
+		a.SetDryRun(&out)
+	})
+
+	env.fifa.AddMatch(testMatch("3"))
+	eventID, err := env.fifa.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.YellowCard, MatchMinute: "5'", Description: description("Player one is booked")})
+	require.NoError(t, err)
+	a.poll(ctx)
+
+	assert.Empty(t, env.slack.take())
+	assert.Equal(t, "2026-06-11T19:00:00Z match=3 event="+eventID+" 5' :large_yellow_square: Player one is booked\n", out.String())
+	assert.Empty(t, a.health.lastSendError)
+}
+
+func TestAppApplySettings(t *testing.T) {
+	ctx := context.Background()
+	a, env := newTestApp(t)
+	fifaServer, slack := env.fifa, env.slack
+
+	fifaServer.AddMatch(testMatch("3"))
+	a.poll(ctx)
+
+	settings := a.Settings()
+	settings.EventsToSkip = map[go_fifa.MatchEvent]bool{go_fifa.YellowCard: true}
+	settings.PollInterval = 5 * time.Second
+	a.ApplySettings(settings)
+	assert.Equal(t, 3*5*time.Second+30*time.Second, a.maxPollAge())
+
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.YellowCard, MatchMinute: "5'", Description: description("Player one is booked")})
+	require.NoError(t, err)
+	_, err = fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "6'", Description: description("Player two is sent off")})
+	require.NoError(t, err)
+	a.poll(ctx)
+	msgs := slack.take()
+	require.Len(t, msgs, 1)
+	assert.Contains(t, msgs[0], "Player two is sent off")
+
+	// A new webhook is used for the next message of a match already tracked
+	other := newFakeSlack(t)
+	settings.SlackWebhookURL = other.server.URL
+	a.ApplySettings(settings)
+	_, err = fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "7'", Description: description("Player three is sent off")})
+	require.NoError(t, err)
+	a.poll(ctx)
+	assert.Empty(t, slack.take())
+	msgs = other.take()
+	require.Len(t, msgs, 1)
+	assert.Contains(t, msgs[0], "Player three is sent off")
+
+	// Matches outside a newly set competition are no longer picked up
+	settings.CompetitionID = "2000"
+	a.ApplySettings(settings)
+	fifaServer.AddMatch(testMatch("4"))
+	a.poll(ctx)
+	assert.False(t, a.tracking("4"))
+}
+
+func TestAppRedactsSecretsInOpsEndpoints(t *testing.T) {
+	ctx := context.Background()
+	// Nothing listens on the webhook, so the send fails with an error that
+	// includes its URL
+	webhookURL := "http://127.0.0.1:1/services/T000/B000/secret"
+	redactor := new(helper.Redactor)
+	redactor.SetSecrets(webhookURL)
+	recorder := recordSpans(t)
+	history := &historyDatabase{}
+	a, env := newTestApp(t, withSettings(func(s *Settings) { s.SlackWebhookURL = webhookURL }), func(a *app) {
+		a.SetRedactor(redactor)
+		a.SetAdminToken("secret")
+		history.Database = a.db
+		a.db = history
+	})
+
+	env.fifa.AddMatch(testMatch("3"))
+	handler := a.OpsHandler()
+	a.poll(ctx)
+
+	eventID, err := env.fifa.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "6'", Description: description("Player two is sent off")})
+	require.NoError(t, err)
+	a.poll(ctx)
+
+	var status statusResponse
+	getJSON(t, handler, "/status", &status)
+	assert.Contains(t, status.LastNotificationError, "[REDACTED]")
+	var ready readyResponse
+	getJSON(t, handler, "/readyz", &ready)
+	assert.Contains(t, ready.Checks["notifier"], "[REDACTED]")
+	rec := adminRequest(handler, http.MethodPost, "/admin/matches/3/events/"+eventID+"/resend", "")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "[REDACTED]")
+	for _, body := range []string{status.LastNotificationError, ready.Checks["notifier"], rec.Body.String()} {
+		assert.NotContains(t, body, "services/T000")
+	}
+
+	// Nor is it kept in the notification history or exported with spans
+	require.NotEmpty(t, history.errors())
+	for _, e := range history.errors() {
+		assert.Contains(t, e, "[REDACTED]")
+		assert.NotContains(t, e, "services/T000")
+	}
+	failed := 0
+	for _, span := range recorder.Ended() {
+		if span.Status().Code != codes.Error {
+			continue
+		}
+		failed++
+		assert.NotContains(t, span.Status().Description, "services/T000", span.Name())
+		for _, evt := range span.Events() {
+			for _, kv := range evt.Attributes {
+				assert.NotContains(t, kv.Value.Emit(), "services/T000", span.Name())
+			}
+		}
+	}
+	assert.NotZero(t, failed)
+}
+
+// historyDatabase keeps the errors of the notifications recorded in it.
+type historyDatabase struct {
+	database.Database
+	mu   sync.Mutex
+	errs []string
+}
+
+func (d *historyDatabase) RecordNotification(ctx context.Context, matchID string, eventID string, destination string, sendErr error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if sendErr != nil {
+		d.errs = append(d.errs, sendErr.Error())
+	}
+	return nil
+}
+
+func (d *historyDatabase) errors() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.errs)
+}
+
+func TestAppTenants(t *testing.T) {
+	ctx := context.Background()
+	acme := newFakeSlack(t)
+	globex := newFakeSlack(t)
+	a, env := newTestApp(t, withSettings(func(s *Settings) {
+		s.Tenants = []Tenant{
+			{Name: "acme", SlackWebhookURL: acme.server.URL, Competitions: []string{"17"}, EventsToSkip: map[go_fifa.MatchEvent]bool{go_fifa.YellowCard: true}},
+			{Name: "globex", SlackWebhookURL: globex.server.URL, Competitions: []string{"17", "20"}},
+		}
+	}))
+	fifaServer := env.fifa
+
+	for id, competition := range map[string]string{"3": "17", "4": "20", "5": "30"} {
+		match := testMatch(id)
+		match.CompetitionId = competition
+		fifaServer.AddMatch(match)
+	}
+	a.poll(ctx)
+	assert.True(t, a.tracking("3"))
+	assert.True(t, a.tracking("4"))
+	assert.False(t, a.tracking("5"), "no tenant follows competition 30")
+
+	for _, evt := range []struct {
+		matchID string
+		event   go_fifa.TimelineEvent
+	}{
+		{"3", go_fifa.TimelineEvent{Type: go_fifa.YellowCard, MatchMinute: "5'", Description: description("Player one is booked")}},
+		{"3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "6'", Description: description("Player two is sent off")}},
+		{"4", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "7'", Description: description("Player three is sent off")}},
+	} {
+		_, err := fifaServer.PushEvent(evt.matchID, evt.event)
+		require.NoError(t, err)
+	}
+	a.poll(ctx)
+
+	acmeMsgs := acme.take()
+	require.Len(t, acmeMsgs, 1)
+	assert.Contains(t, acmeMsgs[0], "Player two is sent off")
+	globexMsgs := strings.Join(globex.take(), "\n")
+	for _, text := range []string{"Player one is booked", "Player two is sent off", "Player three is sent off"} {
+		assert.Contains(t, globexMsgs, text)
+	}
+
+	// A tenant that fails does not hold back the others
+	acme.status.Store(http.StatusInternalServerError)
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "8'", Description: description("Player four is sent off")})
+	require.NoError(t, err)
+	a.poll(ctx)
+	assert.Empty(t, acme.take())
+	globexMsgs = strings.Join(globex.take(), "\n")
+	assert.Contains(t, globexMsgs, "Player four is sent off")
+}
+
+// contextDatabase fails claims made with a cancelled context, as a backend
+// behind a network connection does.
+type contextDatabase struct {
+	database.Database
+}
+
+func (d contextDatabase) ClaimEvent(ctx context.Context, matchID string, eventID string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return d.Database.ClaimEvent(ctx, matchID, eventID)
+}
+
+func TestAppTenantCustomEvents(t *testing.T) {
+	ctx := context.Background()
+	newCustom := func(name string, icon string, text string) fifa.CustomEvent {
+		c, err := fifa.NewCustomEvent(name, icon, text)
+		require.NoError(t, err)
+		return c
+	}
+	acme := newFakeSlack(t)
+	globex := newFakeSlack(t)
+	a, env := newTestApp(t, withSettings(func(s *Settings) {
+		s.CustomEvents = fifa.CustomEvents{999: newCustom("VARReview", ":tv:", "{{.Icon}} VAR review")}
+		s.Tenants = []Tenant{
+			{Name: "acme", SlackWebhookURL: acme.server.URL, CustomEvents: fifa.CustomEvents{999: newCustom("VARReview", ":tv:", "{{.Icon}} Revisión VAR")}},
+			{Name: "globex", SlackWebhookURL: globex.server.URL, CustomEvents: fifa.CustomEvents{998: newCustom("DrinksBreak", ":cup_with_straw:", "{{.Icon}} Drinks break")}},
+		}
+	}))
+	fifaServer := env.fifa
+
+	fifaServer.AddMatch(testMatch("3"))
+	a.poll(ctx)
+	for _, evt := range []go_fifa.TimelineEvent{
+		{Type: go_fifa.MatchEvent(999), MatchMinute: "5'"},
+		{Type: go_fifa.MatchEvent(998), MatchMinute: "30'"},
+	} {
+		_, err := fifaServer.PushEvent("3", evt)
+		require.NoError(t, err)
+	}
+	a.poll(ctx)
+
+	// A tenant's own custom event replaces the top-level one, and a type only
+	// one tenant maps is sent only to that tenant
+	assert.Equal(t, []string{"5' :tv: Revisión VAR"}, acme.take())
+	assert.Equal(t, []string{"5' :tv: VAR review", "30' :cup_with_straw: Drinks break"}, globex.take())
+}
+
+func TestAppTenantLanguage(t *testing.T) {
+	ctx := context.Background()
+	acme := newFakeSlack(t)
+	globex := newFakeSlack(t)
+	a, env := newTestApp(t, withSettings(func(s *Settings) {
+		s.Tenants = []Tenant{
+			{Name: "acme", SlackWebhookURL: acme.server.URL, Language: "es"},
+			{Name: "globex", SlackWebhookURL: globex.server.URL, Language: "de"},
+		}
+	}))
+	env.fifa.AddMatch(testMatch("3"))
+	a.poll(ctx)
+	_, err := env.fifa.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "8'", Description: []go_fifa.LocaleDescription{
+		{Locale: "en-GB", Description: "Player one is sent off"},
+		{Locale: "es-ES", Description: "Jugador uno es expulsado"},
+	}})
+	require.NoError(t, err)
+	a.poll(ctx)
+
+	// A language the event has no description in falls back to the first
+	assert.Equal(t, []string{"8' :large_red_square: Jugador uno es expulsado"}, acme.take())
+	assert.Equal(t, []string{"8' :large_red_square: Player one is sent off"}, globex.take())
+}
+
+func TestAppTenantCustomEventsKeepShootoutTally(t *testing.T) {
+	ctx := context.Background()
+	newCustom := func(name string, icon string, text string) fifa.CustomEvent {
+		c, err := fifa.NewCustomEvent(name, icon, text)
+		require.NoError(t, err)
+		return c
+	}
+	acme := newFakeSlack(t)
+	globex := newFakeSlack(t)
+	a, env := newTestApp(t, withSettings(func(s *Settings) {
+		s.Tenants = []Tenant{
+			{Name: "acme", SlackWebhookURL: acme.server.URL, CustomEvents: fifa.CustomEvents{
+				go_fifa.PenaltyGoal:   newCustom("Scored", ":soccer:", "{{.Icon}} Scored"),
+				go_fifa.PenaltyMissed: newCustom("Missed", ":x:", "{{.Icon}} Missed"),
+			}},
+			{Name: "globex", SlackWebhookURL: globex.server.URL},
+		}
+	}))
+	match := testMatch("3")
+	match.HomeTeamID = "1"
+	match.AwayTeamID = "2"
+	env.fifa.AddMatch(match)
+	a.poll(ctx)
+	for _, evt := range []go_fifa.TimelineEvent{
+		{Type: go_fifa.PenaltyGoal, Period: go_fifa.ShootoutPeriod, TeamId: "1", MatchMinute: "120'"},
+		{Type: go_fifa.PenaltyMissed, Period: go_fifa.ShootoutPeriod, TeamId: "2", MatchMinute: "120'"},
+	} {
+		_, err := env.fifa.PushEvent("3", evt)
+		require.NoError(t, err)
+	}
+	a.poll(ctx)
+
+	// Each kick counts once, however many tenants render it
+	stored, err := env.db.GetMatch(ctx, "3")
+	require.NoError(t, err)
+	assert.Equal(t, ":large_green_circle:----", stored.HomeTeamPenaltyResults)
+	assert.Equal(t, ":red_circle:----", stored.AwayTeamPenaltyResults)
+	sent := globex.take()
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent[1], ":large_green_circle:---- USA")
+	assert.Equal(t, sent, acme.take())
+}
+
+func TestAppFailingTenantDoesNotStopOtherMatches(t *testing.T) {
+	ctx := context.Background()
+	acme := newFakeSlack(t)
+	globex := newFakeSlack(t)
+	a, env := newTestApp(t, withSettings(func(s *Settings) {
+		s.Tenants = []Tenant{
+			{Name: "acme", SlackWebhookURL: acme.server.URL, Competitions: []string{"17"}},
+			{Name: "globex", SlackWebhookURL: globex.server.URL, Competitions: []string{"18"}},
+		}
+	}), func(a *app) { a.db = contextDatabase{a.db} })
+	fifaServer := env.fifa
+
+	env.fifa.AddMatch(testMatch("3"))
+	other := testMatch("4")
+	other.CompetitionId = "18"
+	fifaServer.AddMatch(other)
+	a.poll(ctx)
+
+	// acme fails while the timeline of globex's match is still loading
+	acme.status.Store(http.StatusInternalServerError)
+	require.NoError(t, fifaServer.SetTimelineDelay("4", 200*time.Millisecond))
+	for _, id := range []string{"3", "4"} {
+		_, err := fifaServer.PushEvent(id, go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "8'", Description: description("Player one is sent off")})
+		require.NoError(t, err)
+	}
+	a.poll(ctx)
+	assert.Empty(t, acme.take())
+	assert.Equal(t, []string{"8' :large_red_square: Player one is sent off"}, globex.take())
+}
+
+// sentryTransport keeps the events sent to Sentry.
+type sentryTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (s *sentryTransport) Flush(time.Duration) bool       { return true }
+func (s *sentryTransport) Configure(sentry.ClientOptions) {}
+func (s *sentryTransport) SendEvent(event *sentry.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *sentryTransport) take() []*sentry.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestAppSentry(t *testing.T) {
+	transport := &sentryTransport{}
+	require.NoError(t, sentry.Init(sentry.ClientOptions{Dsn: "https://key@o0.ingest.sentry.io/1", Transport: transport}))
+	t.Cleanup(func() { sentry.Init(sentry.ClientOptions{}) })
+
+	ctx := context.Background()
+	a, env := newTestApp(t, func(a *app) { a.sentryEnabled = true })
+	fifaServer, slack := env.fifa, env.slack
+
+	fifaServer.AddMatch(testMatch("3"))
+	a.poll(ctx)
+
+	// The same unknown type twice is grouped into one issue, with the events
+	// before it as breadcrumbs
+	for _, evt := range []go_fifa.TimelineEvent{
+		{Type: go_fifa.YellowCard, MatchMinute: "5'", Description: description("Player one is booked")},
+		{Type: go_fifa.MatchEvent(999), MatchMinute: "6'"},
+		{Type: go_fifa.MatchEvent(999), MatchMinute: "7'"},
+	} {
+		_, err := fifaServer.PushEvent("3", evt)
+		require.NoError(t, err)
+	}
+	a.poll(ctx)
+	events := transport.take()
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.Equal(t, []string{"unknown-event", "999"}, event.Fingerprint)
+		assert.Equal(t, "3", event.Tags["match_id"])
+		require.NotEmpty(t, event.Breadcrumbs)
+		assert.Equal(t, "YellowCard 5'", event.Breadcrumbs[0].Message)
+	}
+	assert.Len(t, events[1].Breadcrumbs, 2, "the first unknown event leads up to the second")
+
+	// Failed sends are captured along with the match
+	slack.status.Store(http.StatusInternalServerError)
+	_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.RedCard, MatchMinute: "8'", Description: description("Player two is sent off")})
+	require.NoError(t, err)
+	a.poll(ctx)
+	events = transport.take()
+	require.Len(t, events, 1)
+	assert.Equal(t, []string{"notifier", "slack"}, events[0].Fingerprint)
+	assert.Equal(t, "notifier", events[0].Tags["component"])
+	assert.Equal(t, "USA", events[0].Tags["home_team"])
+	require.NotEmpty(t, events[0].Exception)
+	assert.Contains(t, events[0].Exception[len(events[0].Exception)-1].Value, "500 Internal Server Error")
+}
+
+func TestAppQuarantinesUnknownEvents(t *testing.T) {
+	ctx := context.Background()
+	a, env := newTestApp(t, func(a *app) { a.SetAdminToken("secret") })
+	fifaServer, slack := env.fifa, env.slack
+
+	fifaServer.AddMatch(testMatch("3"))
+	handler := a.OpsHandler()
+	a.poll(ctx)
+
+	for _, minute := range []string{"6'", "7'"} {
+		_, err := fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.MatchEvent(999), MatchMinute: minute})
+		require.NoError(t, err)
+	}
+	a.poll(ctx)
+	assert.Empty(t, slack.take())
+
+	rec := adminRequest(handler, http.MethodGet, "/admin/unknown-events", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var types []models.UnknownEventType
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &types))
+	require.Len(t, types, 1)
+	assert.Equal(t, 999, types[0].Type)
+	assert.Equal(t, 2, types[0].Count)
+	assert.Equal(t, []string{"3"}, types[0].Matches)
+	assert.Equal(t, "7'", types[0].Latest.Minute)
+	assert.Contains(t, string(types[0].Latest.Payload), `"MatchMinute":"7'"`)
+
+	// Once the type is mapped it is sent like any other event
+	custom, err := fifa.NewCustomEvent("VARReview", ":tv:", "{{.Icon}} VAR review {{.Score}}")
+	require.NoError(t, err)
+	settings := a.Settings()
+	settings.CustomEvents = fifa.CustomEvents{999: custom}
+	a.ApplySettings(settings)
+	_, err = fifaServer.PushEvent("3", go_fifa.TimelineEvent{Type: go_fifa.MatchEvent(999), MatchMinute: "8'"})
+	require.NoError(t, err)
+	a.poll(ctx)
+	assert.Equal(t, []string{"8' :tv: VAR review 0 USA :flag-us: : :flag-mx: MEX 0"}, slack.take())
+
+	rec = adminRequest(handler, http.MethodDelete, "/admin/unknown-events/999", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"deleted":2}`, rec.Body.String())
+	require.NoError(t, json.Unmarshal(adminRequest(handler, http.MethodGet, "/admin/unknown-events", "").Body.Bytes(), &types))
+	assert.Empty(t, types)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(handler, http.MethodDelete, "/admin/unknown-events/var", "").Code)
+}
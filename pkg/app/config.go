@@ -2,34 +2,172 @@ package app
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
+const (
+	StorageRedis    = "redis"
+	StorageMemory   = "memory"
+	StorageBolt     = "bolt"
+	StoragePostgres = "postgres"
+)
+
 type Config struct {
-	SlackWebhookURL  string `mapstructure:"slack_webhook_url"`
-	CompetitionID    string `mapstructure:"competition_id"`
-	SleepTimeSeconds int    `mapstructure:"sleep_time_seconds"`
-	Redis            struct {
+	SlackWebhookURL string `mapstructure:"slack_webhook_url"`
+	// SlackWebhookURLFile is a file to read slack_webhook_url from, such as a
+	// mounted Docker or Kubernetes secret.
+	SlackWebhookURLFile string `mapstructure:"slack_webhook_url_file"`
+	CompetitionID       string `mapstructure:"competition_id"`
+	SleepTimeSeconds    int    `mapstructure:"sleep_time_seconds"`
+	Storage             string `mapstructure:"storage"`
+	// MatchTTLHours is how long a stored match is kept after its last update.
+	MatchTTLHours int `mapstructure:"match_ttl_hours"`
+	// StaleMatchGraceMinutes is how long a match can be missing from FIFA's
+	// live matches before it is retired.
+	StaleMatchGraceMinutes int `mapstructure:"stale_match_grace_minutes"`
+	Redis                  struct {
 		Address  string `mapstructure:"address"`
 		Password string `mapstructure:"password"`
-		Database int    `mapstructure:"database"`
+		// PasswordFile is a file to read password from.
+		PasswordFile string `mapstructure:"password_file"`
+		Database     int    `mapstructure:"database"`
+		// Namespace is prepended to every key, so deployments can share a Redis.
+		Namespace string `mapstructure:"namespace"`
+		// MigrateUnprefixedKeys moves keys written before a namespace was set
+		// into the namespace on startup.
+		MigrateUnprefixedKeys bool `mapstructure:"migrate_unprefixed_keys"`
 	} `mapstructure:"redis"`
-	LogLevel        string   `mapstructure:"log_level"`
-	EnableProfiling bool     `mapstructure:"enable_profiling"`
-	ProfilingPort   int      `mapstructure:"profiling_port"`
-	SkipEvents      []string `mapstructure:"skip_events"`
-	SentryDSN       string   `mapstructure:"sentry_dsn"`
+	Bolt struct {
+		Path string `mapstructure:"path"`
+	} `mapstructure:"bolt"`
+	Postgres struct {
+		URL string `mapstructure:"url"`
+	} `mapstructure:"postgres"`
+	HA struct {
+		Enabled bool `mapstructure:"enabled"`
+		// InstanceID identifies this replica in the lease. Defaults to the
+		// hostname.
+		InstanceID      string `mapstructure:"instance_id"`
+		LeaseTTLSeconds int    `mapstructure:"lease_ttl_seconds"`
+	} `mapstructure:"ha"`
+	Shard struct {
+		Enabled bool `mapstructure:"enabled"`
+		// WorkerID identifies this worker on the hash ring. Defaults to the
+		// hostname.
+		WorkerID            string `mapstructure:"worker_id"`
+		HeartbeatTTLSeconds int    `mapstructure:"heartbeat_ttl_seconds"`
+	} `mapstructure:"shard"`
+	Tracing struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Endpoint is the OTLP/HTTP collector, either host:port or a full URL.
+		Endpoint string `mapstructure:"endpoint"`
+		// Insecure sends spans over plain HTTP.
+		Insecure    bool    `mapstructure:"insecure"`
+		SampleRatio float64 `mapstructure:"sample_ratio"`
+		ServiceName string  `mapstructure:"service_name"`
+	} `mapstructure:"tracing"`
+	// DryRun runs against live FIFA data but writes messages to
+	// DryRunOutput, or stdout, instead of Slack and keeps state in memory.
+	DryRun          bool   `mapstructure:"dry_run"`
+	DryRunOutput    string `mapstructure:"dry_run_output"`
+	LogLevel        string `mapstructure:"log_level"`
+	EnableProfiling bool   `mapstructure:"enable_profiling"`
+	ProfilingPort   int    `mapstructure:"profiling_port"`
+	EnableOpsServer bool   `mapstructure:"enable_ops_server"`
+	OpsPort         int    `mapstructure:"ops_port"`
+	// AdminToken enables the admin API on the ops server. Requests must send
+	// it as a bearer token.
+	AdminToken string   `mapstructure:"admin_token"`
+	SkipEvents []string `mapstructure:"skip_events"`
+	SentryDSN  string   `mapstructure:"sentry_dsn"`
+	// SentryDSNFile is a file to read sentry_dsn from.
+	SentryDSNFile string `mapstructure:"sentry_dsn_file"`
+	// SentryEnvironment tells deployments apart in Sentry, such as
+	// "production" or "staging".
+	SentryEnvironment string `mapstructure:"sentry_environment"`
+	// Tenants are the Slack workspaces to post to, each with its own webhook,
+	// competitions and skip list. They replace slack_webhook_url and
+	// competition_id.
+	Tenants []TenantConfig `mapstructure:"tenants"`
+	// StrictConfig makes validation warnings, such as an unknown skip_events
+	// name, fail the config.
+	StrictConfig bool `mapstructure:"strict_config"`
+	// CustomEvents give event types the bot does not know a name and message,
+	// so they are posted rather than only quarantined.
+	CustomEvents []CustomEventConfig `mapstructure:"custom_events"`
+}
+
+// CustomEventConfig maps a FIFA event type code to a name and message.
+type CustomEventConfig struct {
+	Type int    `mapstructure:"type"`
+	Name string `mapstructure:"name"`
+	Icon string `mapstructure:"icon"`
+	// Template is a text/template executed with fifa.CustomEventData. It
+	// defaults to fifa.DefaultCustomEventTemplate.
+	Template string `mapstructure:"template"`
+}
+
+// TenantConfig is a Slack workspace in the config.
+type TenantConfig struct {
+	Name                string `mapstructure:"name"`
+	SlackWebhookURL     string `mapstructure:"slack_webhook_url"`
+	SlackWebhookURLFile string `mapstructure:"slack_webhook_url_file"`
+	// Competitions limits the tenant to matches of these competitions. Empty
+	// means every competition.
+	Competitions []string `mapstructure:"competitions"`
+	// SkipEvents are skipped for this tenant along with the top-level
+	// skip_events.
+	SkipEvents []string `mapstructure:"skip_events"`
+	// CustomEvents add custom events for this tenant, or replace the
+	// top-level custom event of the same type.
+	CustomEvents []CustomEventConfig `mapstructure:"custom_events"`
+	// Language picks the language of event descriptions, such as "es" or
+	// "es-ES". Descriptions FIFA has no translation for stay in English.
+	Language string `mapstructure:"language"`
 }
 
-func LoadConfig(configPath string) (*Config, error) {
+// LoadConfig reads and validates the config file at configPath. overrides,
+// such as command-line flags, change the config before it is validated.
+func LoadConfig(configPath string, overrides ...func(*Config)) (*Config, error) {
 	v := viper.New()
 
 	v.SetDefault("sleep_time_seconds", 60)
+	v.SetDefault("storage", StorageRedis)
+	v.SetDefault("match_ttl_hours", 24)
+	v.SetDefault("stale_match_grace_minutes", 30)
+	v.SetDefault("bolt.path", "fifa-bot.db")
+	v.SetDefault("ha.enabled", false)
+	v.SetDefault("ha.lease_ttl_seconds", 15)
+	v.SetDefault("shard.enabled", false)
+	v.SetDefault("shard.heartbeat_ttl_seconds", 15)
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("tracing.endpoint", "localhost:4318")
+	v.SetDefault("tracing.insecure", false)
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("tracing.service_name", "fifa-bot")
+	v.SetDefault("dry_run", false)
 	v.SetDefault("log_level", "WARN")
 	v.SetDefault("enable_profiling", false)
 	v.SetDefault("profiling_port", 8080)
+	v.SetDefault("enable_ops_server", false)
+	v.SetDefault("ops_port", 8081)
+	v.SetDefault("sentry_environment", "production")
+	v.SetDefault("strict_config", false)
+	// Without a default the secret file settings could not be set from the
+	// environment alone
+	v.SetDefault("slack_webhook_url_file", "")
+	v.SetDefault("redis.password_file", "")
+	v.SetDefault("sentry_dsn_file", "")
 
 	v.SetConfigFile(configPath)
 	v.SetConfigType("yaml")
@@ -46,17 +184,218 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	var missing []string
-	if cfg.SlackWebhookURL == "" {
-		missing = append(missing, "slack_webhook_url")
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, err
 	}
-	if cfg.Redis.Address == "" {
-		missing = append(missing, "redis.address")
+
+	for _, override := range overrides {
+		override(&cfg)
+	}
+	if cfg.DryRun {
+		// Nothing may be written to shared storage, so state stays in memory
+		// and this instance runs on its own
+		cfg.Storage = StorageMemory
+		cfg.HA.Enabled = false
+		cfg.Shard.Enabled = false
+	}
+
+	if _, err := cfg.Validate(cfg.StrictConfig); err != nil {
+		return nil, err
+	}
+
+	if cfg.HA.Enabled && cfg.HA.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("ha.instance_id is not set and the hostname is unavailable: %w", err)
+		}
+		cfg.HA.InstanceID = hostname
 	}
 
-	if len(missing) > 0 {
-		return nil, fmt.Errorf("required config fields are missing: %s", strings.Join(missing, ", "))
+	if cfg.Shard.Enabled && cfg.Shard.WorkerID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("shard.worker_id is not set and the hostname is unavailable: %w", err)
+		}
+		cfg.Shard.WorkerID = hostname
 	}
 
 	return &cfg, nil
 }
+
+// secretFile is a secret setting along with the setting naming a file to read
+// it from.
+type secretFile struct {
+	name  string
+	value *string
+	path  string
+}
+
+func (cfg *Config) secretFiles() []secretFile {
+	files := []secretFile{
+		{"slack_webhook_url", &cfg.SlackWebhookURL, cfg.SlackWebhookURLFile},
+		{"redis.password", &cfg.Redis.Password, cfg.Redis.PasswordFile},
+		{"sentry_dsn", &cfg.SentryDSN, cfg.SentryDSNFile},
+	}
+	for i := range cfg.Tenants {
+		tenant := &cfg.Tenants[i]
+		files = append(files, secretFile{fmt.Sprintf("tenants[%d].slack_webhook_url", i), &tenant.SlackWebhookURL, tenant.SlackWebhookURLFile})
+	}
+	return files
+}
+
+// readSecretFiles sets each secret that has a file from the file's content,
+// without surrounding whitespace.
+func (cfg *Config) readSecretFiles() error {
+	var problems []string
+	for _, secret := range cfg.secretFiles() {
+		if secret.path == "" {
+			continue
+		}
+		if *secret.value != "" {
+			problems = append(problems, fmt.Sprintf("%s and %s_file are both set, use only one", secret.name, secret.name))
+			continue
+		}
+		b, err := os.ReadFile(secret.path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to read %s_file. %s", secret.name, err))
+			continue
+		}
+		*secret.value = strings.TrimSpace(string(b))
+		if *secret.value == "" {
+			problems = append(problems, fmt.Sprintf("%s_file %s is empty", secret.name, secret.path))
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// Secrets returns the secret values in the config, to be kept out of logs.
+func (cfg *Config) Secrets() []string {
+	secrets := []string{cfg.SlackWebhookURL, cfg.Redis.Password, cfg.SentryDSN, cfg.AdminToken}
+	for _, tenant := range cfg.Tenants {
+		secrets = append(secrets, tenant.SlackWebhookURL)
+	}
+	if u, err := url.Parse(cfg.Postgres.URL); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			secrets = append(secrets, password)
+		}
+	}
+	return secrets
+}
+
+// LiveConfigFields are the settings a running bot picks up when the config
+// file changes. A change to any other field needs a restart.
+var LiveConfigFields = []string{
+	"slack_webhook_url",
+	"competition_id",
+	"sleep_time_seconds",
+	"skip_events",
+	"stale_match_grace_minutes",
+	"log_level",
+	"strict_config",
+	"tenants",
+	"custom_events",
+}
+
+// ChangedConfigFields returns the names of the top-level settings that differ
+// between old and new, such as "skip_events" or "redis".
+func ChangedConfigFields(old *Config, new *Config) []string {
+	var changed []string
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*new)
+	for i := range oldValue.NumField() {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, oldValue.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return changed
+}
+
+// WatchConfig reloads the config each time the file at configPath, or one of
+// the secret files it names, changes and passes it to onChange. A file that
+// fails to load or validate is passed to onError instead, and the caller
+// should keep its running config. overrides are applied to each reload as
+// LoadConfig does.
+func WatchConfig(configPath string, onChange func(*Config), onError func(error), overrides ...func(*Config)) {
+	// The config file and the secret files are watched separately, and
+	// onChange is not expected to cope with overlapping calls
+	var mu sync.Mutex
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		cfg, err := LoadConfig(configPath, overrides...)
+		if err != nil {
+			onError(err)
+			return
+		}
+		onChange(cfg)
+	}
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	v.OnConfigChange(func(e fsnotify.Event) {
+		reload()
+	})
+	v.WatchConfig()
+
+	// The secret files in use when watching starts are watched. Pointing a
+	// setting at another file needs a restart.
+	cfg, err := LoadConfig(configPath, overrides...)
+	if err != nil {
+		return
+	}
+	var paths []string
+	for _, secret := range cfg.secretFiles() {
+		if secret.path != "" {
+			paths = append(paths, secret.path)
+		}
+	}
+	if err := watchFiles(paths, reload); err != nil {
+		onError(err)
+	}
+}
+
+// watchFiles calls onChange when any of the files at paths changes. Their
+// directories are watched rather than the files, since Kubernetes rotates a
+// mounted secret by swapping a symlink next to it.
+func watchFiles(paths []string, onChange func()) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch secret files. %w", err)
+	}
+	names := map[string]bool{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if !slices.Contains(watcher.WatchList(), dir) {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return fmt.Errorf("failed to watch secret file %s. %w", path, err)
+			}
+		}
+		names[filepath.Clean(path)] = true
+	}
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Kubernetes writes secrets to a new ..<timestamp> directory
+				// and then points ..data at it
+				if names[filepath.Clean(event.Name)] || strings.HasPrefix(filepath.Base(event.Name), "..") {
+					onChange()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("failed to watch secret files", "error", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,304 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	go_fifa "github.com/imdevinc/go-fifa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `slack_webhook_url: "https://hooks.slack.com/services/test"
+storage: memory
+sleep_time_seconds: 60
+skip_events: [YellowCard]
+`
+
+func writeConfig(t *testing.T, path string, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestChangedConfigFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, testConfig)
+	old, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	writeConfig(t, path, testConfig+"competition_id: \"17\"\nredis:\n  address: localhost:6379\n")
+	updated, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Empty(t, ChangedConfigFields(old, old))
+	assert.Equal(t, []string{"competition_id", "redis"}, ChangedConfigFields(old, updated))
+}
+
+func TestWatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, testConfig)
+	changes := make(chan *Config, 10)
+	errs := make(chan error, 10)
+	WatchConfig(path, func(cfg *Config) { changes <- cfg }, func(err error) { errs <- err })
+
+	writeConfig(t, path, "slack_webhook_url: \"https://hooks.slack.com/services/test\"\nstorage: memory\nsleep_time_seconds: 30\n")
+	select {
+	case cfg := <-changes:
+		assert.Equal(t, 30, cfg.SleepTimeSeconds)
+		assert.Empty(t, cfg.SkipEvents)
+	case err := <-errs:
+		t.Fatalf("unexpected reload error: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not picked up")
+	}
+
+	// A broken file is reported and not passed on
+	writeConfig(t, path, "storage: nowhere\n")
+	for {
+		select {
+		case <-changes:
+			continue
+		case err := <-errs:
+			assert.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("broken config was not reported")
+		}
+		break
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, testConfig)
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	warnings, err := cfg.Validate(true)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	// Every problem is reported at once
+	writeConfig(t, path, `slack_webhook_url: "hooks.slack.com/services/test"
+storage: memory
+sleep_time_seconds: 0
+competition_id: "world-cup"
+skip_events: [yellowcard]
+`)
+	_, err = LoadConfig(path)
+	var cfgErr *ConfigError
+	require.ErrorAs(t, err, &cfgErr)
+	assert.Len(t, cfgErr.Problems, 3)
+	assert.Contains(t, cfgErr.Problems[0], "slack_webhook_url must be an absolute http or https URL")
+	assert.Contains(t, cfgErr.Problems[1], `competition_id must be a numeric FIFA competition ID such as "17", got "world-cup"`)
+	assert.Equal(t, "sleep_time_seconds must be at least 1, got 0", cfgErr.Problems[2])
+
+	// Warnings only fail the config when strict
+	base := "slack_webhook_url: \"https://hooks.slack.com/services/test\"\nstorage: memory\n"
+	writeConfig(t, path, base+"skip_events: [yellowcard, Offside]\n")
+	cfg, err = LoadConfig(path)
+	require.NoError(t, err)
+	warnings, err = cfg.Validate(false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`unknown event name "yellowcard" in skip_events, did you mean "YellowCard"?`}, warnings)
+	_, err = cfg.Validate(true)
+	require.ErrorAs(t, err, &cfgErr)
+	assert.Equal(t, warnings, cfgErr.Problems)
+	assert.Empty(t, cfgErr.Warnings)
+
+	writeConfig(t, path, base+"skip_events: [yellowcard]\nstrict_config: true\n")
+	_, err = LoadConfig(path)
+	assert.ErrorAs(t, err, &cfgErr)
+
+	// Namespaces whose keys look unprefixed, or that are scan patterns
+	for _, namespace := range []string{"match", "match:prod", "prod*"} {
+		writeConfig(t, path, base+"redis:\n  namespace: \""+namespace+"\"\n")
+		_, err = LoadConfig(path)
+		require.ErrorAs(t, err, &cfgErr, namespace)
+		assert.Contains(t, cfgErr.Problems[0], "redis.namespace cannot")
+	}
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	webhookFile := filepath.Join(dir, "webhook")
+	writeConfig(t, webhookFile, "https://hooks.slack.com/services/first\n")
+	writeConfig(t, path, "slack_webhook_url_file: "+webhookFile+"\nstorage: memory\n")
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.slack.com/services/first", cfg.SlackWebhookURL)
+	assert.Contains(t, cfg.Secrets(), cfg.SlackWebhookURL)
+
+	// A rotated secret is picked up like a config change
+	changes := make(chan *Config, 10)
+	errs := make(chan error, 10)
+	WatchConfig(path, func(cfg *Config) { changes <- cfg }, func(err error) { errs <- err })
+	writeConfig(t, webhookFile, "https://hooks.slack.com/services/second\n")
+	select {
+	case cfg := <-changes:
+		assert.Equal(t, "https://hooks.slack.com/services/second", cfg.SlackWebhookURL)
+	case err := <-errs:
+		t.Fatalf("unexpected reload error: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("secret rotation was not picked up")
+	}
+
+	// Setting both the value and its file is ambiguous
+	writeConfig(t, path, "slack_webhook_url: \"https://hooks.slack.com/services/test\"\nslack_webhook_url_file: "+webhookFile+"\nredis:\n  password_file: "+filepath.Join(dir, "missing")+"\nstorage: memory\n")
+	_, err = LoadConfig(path)
+	var cfgErr *ConfigError
+	require.ErrorAs(t, err, &cfgErr)
+	require.Len(t, cfgErr.Problems, 2)
+	assert.Equal(t, "slack_webhook_url and slack_webhook_url_file are both set, use only one", cfgErr.Problems[0])
+	assert.Contains(t, cfgErr.Problems[1], "failed to read redis.password_file")
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "storage: postgres\nha:\n  enabled: true\n  instance_id: test\n")
+	_, err := LoadConfig(path)
+	require.Error(t, err)
+
+	// Dry-run mode is applied before validation, so what it turns off is not
+	// required
+	cfg, err := LoadConfig(path, func(cfg *Config) { cfg.DryRun = true })
+	require.NoError(t, err)
+	assert.Equal(t, StorageMemory, cfg.Storage)
+	assert.False(t, cfg.HA.Enabled)
+}
+
+func TestConfigTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `storage: memory
+skip_events: [Offside]
+tenants:
+  - name: acme
+    slack_webhook_url: "https://hooks.slack.com/services/acme"
+    competitions: ["17"]
+    skip_events: [YellowCard]
+    language: es
+  - name: globex
+    slack_webhook_url: "https://hooks.slack.com/services/globex"
+`)
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	tenants := TenantsFromConfig(cfg)
+	require.Len(t, tenants, 2)
+	assert.Equal(t, []string{"17"}, tenants[0].Competitions)
+	assert.Equal(t, "es", tenants[0].Language)
+	assert.Empty(t, tenants[1].Language)
+	assert.Equal(t, map[go_fifa.MatchEvent]bool{go_fifa.Offside: true, go_fifa.YellowCard: true}, tenants[0].EventsToSkip)
+	assert.Equal(t, map[go_fifa.MatchEvent]bool{go_fifa.Offside: true}, tenants[1].EventsToSkip)
+	assert.Contains(t, cfg.Secrets(), "https://hooks.slack.com/services/globex")
+
+	// A tenant's custom events replace the top-level ones of the same type
+	// and can be named in its skip list
+	writeConfig(t, path, `storage: memory
+custom_events:
+  - type: 999
+    name: VARReview
+tenants:
+  - name: acme
+    slack_webhook_url: "https://hooks.slack.com/services/acme"
+    skip_events: [DrinksBreak]
+    custom_events:
+      - type: 999
+        name: VARReview
+        template: "Revisión VAR"
+      - type: 998
+        name: DrinksBreak
+`)
+	cfg, err = LoadConfig(path)
+	require.NoError(t, err)
+	warnings, err := cfg.Validate(true)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	tenants = TenantsFromConfig(cfg)
+	require.Len(t, tenants, 1)
+	assert.Len(t, tenants[0].CustomEvents, 2)
+	assert.Equal(t, map[go_fifa.MatchEvent]bool{998: true}, tenants[0].EventsToSkip)
+
+	writeConfig(t, path, `storage: memory
+custom_events:
+  - type: 999
+    name: VARReview
+tenants:
+  - name: acme
+    slack_webhook_url: "https://hooks.slack.com/services/acme"
+    custom_events:
+      - type: 998
+        name: VARReview
+`)
+	_, err = LoadConfig(path)
+	var tenantErr *ConfigError
+	require.ErrorAs(t, err, &tenantErr)
+	assert.Equal(t, []string{`tenants[acme].custom_events[0].name "VARReview" is used by another custom event`}, tenantErr.Problems)
+
+	writeConfig(t, path, `storage: memory
+slack_webhook_url: "https://hooks.slack.com/services/test"
+tenants:
+  - name: acme
+    competitions: ["world-cup"]
+    language: spanish
+  - name: acme
+    slack_webhook_url: "https://hooks.slack.com/services/acme"
+`)
+	_, err = LoadConfig(path)
+	var cfgErr *ConfigError
+	require.ErrorAs(t, err, &cfgErr)
+	assert.Equal(t, []string{
+		"slack_webhook_url cannot be combined with tenants, set slack_webhook_url on each tenant",
+		"tenants[acme].slack_webhook_url or tenants[acme].slack_webhook_url_file is required",
+		`tenants[acme].competitions must be a numeric FIFA competition ID such as "17", got "world-cup"`,
+		`tenants[acme].language must be a language code such as "es" or "es-ES", got "spanish"`,
+		`tenants[1].name "acme" is used by another tenant`,
+	}, cfgErr.Problems)
+}
+
+func TestConfigCustomEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `storage: memory
+slack_webhook_url: "https://hooks.slack.com/services/test"
+skip_events: [DrinksBreak]
+custom_events:
+  - type: 999
+    name: VARReview
+    icon: ":tv:"
+    template: "{{.Icon}} VAR review: {{.Description}}"
+  - type: 998
+    name: DrinksBreak
+`)
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	warnings, err := cfg.Validate(true)
+	require.NoError(t, err, "custom event names are accepted in skip_events")
+	assert.Empty(t, warnings)
+	custom := CustomEventsFromConfig(cfg)
+	require.Len(t, custom, 2)
+	assert.Equal(t, "VARReview", custom.Name(999))
+	assert.Equal(t, "YellowCard", custom.Name(go_fifa.YellowCard))
+
+	writeConfig(t, path, `storage: memory
+slack_webhook_url: "https://hooks.slack.com/services/test"
+custom_events:
+  - type: 0
+    name: var-review
+  - type: 999
+    name: YellowCard
+  - type: 999
+    name: Review
+    template: "{{.Player}}"
+`)
+	_, err = LoadConfig(path)
+	var cfgErr *ConfigError
+	require.ErrorAs(t, err, &cfgErr)
+	require.Len(t, cfgErr.Problems, 5)
+	assert.Equal(t, "custom_events[0].type must be a FIFA event type code such as 99, got 0", cfgErr.Problems[0])
+	assert.Equal(t, `custom_events[0].name must be letters and digits starting with a letter, such as "VARReview", got "var-review"`, cfgErr.Problems[1])
+	assert.Equal(t, `custom_events[1].name "YellowCard" is the name of a built-in event`, cfgErr.Problems[2])
+	assert.Equal(t, "custom_events[2].type 999 is mapped by another custom event", cfgErr.Problems[3])
+	assert.Contains(t, cfgErr.Problems[4], "custom_events[2].template is invalid")
+	assert.Contains(t, cfgErr.Problems[4], "can't evaluate field Player")
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+)
+
+// loadControls reads the admin controls from storage, so that controls set
+// through another instance, or before a restart, apply to this one.
+func (a *app) loadControls(ctx context.Context) error {
+	controls, err := a.db.GetControls(ctx)
+	if err != nil {
+		a.captureError(componentStorage, "get_controls", nil, err)
+		return fmt.Errorf("failed to get admin controls from the database. %w", err)
+	}
+	a.matchMutex.Lock()
+	a.controls = controls
+	a.matchMutex.Unlock()
+	return nil
+}
+
+// hasControl reports whether control was on for matchID when controls were
+// last read.
+func (a *app) hasControl(control models.Control, matchID string) bool {
+	a.matchMutex.Lock()
+	defer a.matchMutex.Unlock()
+	return a.controls.Has(control, matchID)
+}
+
+// setControl turns a control on or off in storage, and in this instance
+// straight away.
+func (a *app) setControl(ctx context.Context, control models.Control, matchID string, on bool) error {
+	if err := a.db.SetControl(ctx, control, matchID, on); err != nil {
+		return err
+	}
+	a.matchMutex.Lock()
+	a.controls.Set(control, matchID, on)
+	a.matchMutex.Unlock()
+	return nil
+}
+
+// untrackedControls are turned off when a match is no longer tracked.
+var untrackedControls = []models.Control{models.ControlForced, models.ControlPaused, models.ControlReset}
+
+// clearMatchControls turns off the controls of a match that is no longer
+// tracked, so they do not apply if its ID is tracked again.
+func (a *app) clearMatchControls(ctx context.Context, matchID string) {
+	for _, control := range untrackedControls {
+		if err := a.setControl(ctx, control, matchID, false); err != nil {
+			slog.Error("failed to clear admin control", "matchId", matchID, "control", control, "error", err)
+			a.captureError(componentStorage, "set_control", nil, err)
+		}
+	}
+}
+
+// notificationsPaused reports whether messages for a match are held back.
+func (a *app) notificationsPaused(matchID string) bool {
+	a.matchMutex.Lock()
+	defer a.matchMutex.Unlock()
+	return a.controls.Has(models.ControlPaused, "") || a.controls.Has(models.ControlPaused, matchID)
+}
+
+// applyControls brings the tracked matches in line with the admin controls,
+// given the IDs of the matches FIFA lists as live. It runs between polls of
+// the matches, so a reset never races with the match being processed.
+func (a *app) applyControls(ctx context.Context, live map[string]bool) error {
+	a.matchMutex.Lock()
+	controls := a.controls.Clone()
+	a.matchMutex.Unlock()
+
+	for id := range controls[models.ControlUntracked] {
+		if a.tracking(id) {
+			// Untracked through another instance
+			a.forgetMatch(id)
+		}
+		if live[id] {
+			continue
+		}
+		// The match is over, so it may be picked up again if it ever
+		// comes back
+		if err := a.setControl(ctx, models.ControlUntracked, id, false); err != nil {
+			slog.Error("failed to clear admin control", "matchId", id, "control", models.ControlUntracked, "error", err)
+		}
+	}
+
+	now := a.now()
+	for id := range controls[models.ControlForced] {
+		if a.tracking(id) || !a.owns(id) {
+			continue
+		}
+		match, err := a.db.GetMatch(ctx, id)
+		if errors.Is(err, database.ErrMatchNotFound) {
+			slog.Info("forced match is no longer stored, clearing its controls", "matchId", id)
+			a.clearMatchControls(ctx, id)
+			continue
+		}
+		if err != nil {
+			a.captureError(componentStorage, "get_match", nil, err)
+			return fmt.Errorf("failed to get match %s from database. %w", id, err)
+		}
+		slog.Debug("tracking match forced by admin", "matchID", id)
+		a.matchMutex.Lock()
+		a.matches[id] = match
+		a.lastSeenLive[id] = now
+		a.matchMutex.Unlock()
+	}
+
+	for id := range controls[models.ControlReset] {
+		a.matchMutex.Lock()
+		match, tracked := a.matches[id]
+		a.matchMutex.Unlock()
+		if !tracked {
+			// Left for the instance tracking the match
+			continue
+		}
+		if err := a.resetMatch(ctx, match); err != nil {
+			a.captureError(componentStorage, "reset_match", &match, err)
+			return err
+		}
+		if err := a.setControl(ctx, models.ControlReset, id, false); err != nil {
+			return fmt.Errorf("failed to clear reset of match %s. %w", id, err)
+		}
+	}
+	return nil
+}
+
+// resetMatch forgets which events of a match were processed, along with their
+// records.
+func (a *app) resetMatch(ctx context.Context, match models.Match) error {
+	match.Events = nil
+	match.LastEvent = ""
+	match.HomeTeamPenaltyResults = ""
+	match.AwayTeamPenaltyResults = ""
+	if err := a.db.ResetMatch(ctx, match.MatchId); err != nil {
+		return err
+	}
+	if err := a.db.UpdateMatch(ctx, match); err != nil {
+		return fmt.Errorf("failed to update match %s in database. %w", match.MatchId, err)
+	}
+	a.matchMutex.Lock()
+	a.matches[match.MatchId] = match
+	a.matchMutex.Unlock()
+	slog.Info("match events reset by admin", "matchId", match.MatchId)
+	return nil
+}
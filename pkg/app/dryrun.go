@@ -0,0 +1,64 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	destinationSlack  = "slack"
+	destinationDryRun = "dry_run"
+)
+
+// dryRun receives rendered messages in place of Slack.
+type dryRun struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// SetDryRun makes the app write every message it would send to w, one line
+// per message, instead of posting it to Slack.
+func (a *app) SetDryRun(w io.Writer) {
+	a.dryRun = &dryRun{w: w}
+}
+
+// destination names where a tenant's messages go, for metrics, traces and
+// history. Named tenants are told apart as "slack:<tenant>".
+func (a *app) destination(tenant Tenant) string {
+	destination := destinationSlack
+	if a.dryRun != nil {
+		destination = destinationDryRun
+	}
+	if tenant.Name != "" {
+		destination += ":" + tenant.Name
+	}
+	return destination
+}
+
+// destinationKind strips the tenant from a destination.
+func destinationKind(destination string) string {
+	kind, _, _ := strings.Cut(destination, ":")
+	return kind
+}
+
+// deliver sends the message of an event to the tenant's Slack, or writes it
+// out in dry-run mode.
+func (a *app) deliver(tenant Tenant, matchID string, eventID string, text string) error {
+	if a.dryRun == nil {
+		return PostToSlack(tenant.SlackWebhookURL, text)
+	}
+	prefix := ""
+	if tenant.Name != "" {
+		prefix = "tenant=" + tenant.Name + " "
+	}
+	a.dryRun.mu.Lock()
+	defer a.dryRun.mu.Unlock()
+	_, err := fmt.Fprintf(a.dryRun.w, "%s %smatch=%s event=%s %s\n", a.now().UTC().Format(time.RFC3339), prefix, matchID, eventID, text)
+	if err != nil {
+		return fmt.Errorf("failed to write dry-run message. %w", err)
+	}
+	return nil
+}
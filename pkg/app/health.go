@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/metrics"
+)
+
+// health keeps the outcome of recent polls and sends for the ops endpoints.
+type health struct {
+	mu              sync.Mutex
+	started         time.Time
+	lastPoll        time.Time
+	lastPollError   string
+	lastPollErrorAt time.Time
+	lastSend        time.Time
+	lastSendError   string
+	matches         map[string]matchHealth
+}
+
+type matchHealth struct {
+	lastPolled  time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func newHealth() *health {
+	return &health{
+		started: time.Now(),
+		matches: map[string]matchHealth{},
+	}
+}
+
+// recordPoll stores the outcome of a request for the live matches.
+func (h *health) recordPoll(at time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.lastPollError = err.Error()
+		h.lastPollErrorAt = at
+		return
+	}
+	h.lastPoll = at
+	h.lastPollError = ""
+}
+
+func (h *health) recordMatch(matchID string, at time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.matches[matchID]
+	m.lastPolled = at
+	if err != nil {
+		m.lastError = err.Error()
+		m.lastErrorAt = at
+	} else {
+		m.lastError = ""
+	}
+	h.matches[matchID] = m
+}
+
+func (h *health) recordNotification(at time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSend = at
+	h.lastSendError = ""
+	if err != nil {
+		h.lastSendError = err.Error()
+	}
+}
+
+func (h *health) forgetMatch(matchID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.matches, matchID)
+}
+
+// maxPollAge is how long since the last successful poll before the app is
+// considered wedged. It allows for a couple of slow or failed cycles.
+func (a *app) maxPollAge() time.Duration {
+	return 3*a.settings().PollInterval + 30*time.Second
+}
+
+// OpsHandler serves the health, readiness, status and metrics endpoints, and
+// the admin endpoints when an admin token is set.
+func (a *app) OpsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", a.handleReady)
+	mux.HandleFunc("GET /status", a.handleStatus)
+	mux.Handle("GET /metrics", metrics.Handler())
+	if a.adminToken != "" {
+		a.registerAdminRoutes(mux)
+	}
+	return mux
+}
+
+type readyResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// handleReady reports whether the database is reachable, FIFA was polled
+// recently and the last recent notification went through. A standby in
+// high-availability mode does not poll, so only the database is checked.
+func (a *app) handleReady(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{Ready: true, Checks: map[string]string{}}
+	fail := func(check string, reason string) {
+		resp.Ready = false
+		resp.Checks[check] = a.redactor.Redact(reason)
+	}
+
+	resp.Checks["database"] = "ok"
+	if pinger, ok := a.db.(database.Pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			fail("database", err.Error())
+		}
+	}
+
+	now := a.now()
+	a.health.mu.Lock()
+	lastPoll, lastPollError := a.health.lastPoll, a.health.lastPollError
+	lastSend, lastSendError := a.health.lastSend, a.health.lastSendError
+	a.health.mu.Unlock()
+
+	switch {
+	case !a.isLeader():
+		resp.Checks["fifa_poll"] = "standby"
+	case lastPoll.IsZero():
+		fail("fifa_poll", "no successful poll yet")
+	case now.Sub(lastPoll) > a.maxPollAge():
+		reason := "last successful poll " + now.Sub(lastPoll).Round(time.Second).String() + " ago"
+		if lastPollError != "" {
+			reason += ": " + lastPollError
+		}
+		fail("fifa_poll", reason)
+	default:
+		resp.Checks["fifa_poll"] = "ok"
+	}
+
+	// A failed send stops counting once it is old, since there may be
+	// nothing to send for a while to show it has recovered
+	resp.Checks["notifier"] = "ok"
+	if lastSendError != "" && now.Sub(lastSend) <= a.maxPollAge() {
+		fail("notifier", lastSendError)
+	}
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+type statusResponse struct {
+	Leader                bool          `json:"leader"`
+	Started               time.Time     `json:"started"`
+	LastPoll              time.Time     `json:"last_poll,omitzero"`
+	LastPollError         string        `json:"last_poll_error,omitempty"`
+	LastPollErrorAt       time.Time     `json:"last_poll_error_at,omitzero"`
+	LastNotification      time.Time     `json:"last_notification,omitzero"`
+	LastNotificationError string        `json:"last_notification_error,omitempty"`
+	Matches               []matchStatus `json:"matches"`
+}
+
+type matchStatus struct {
+	MatchID       string    `json:"match_id"`
+	CompetitionID string    `json:"competition_id"`
+	HomeTeam      string    `json:"home_team"`
+	AwayTeam      string    `json:"away_team"`
+	Events        int       `json:"events"`
+	LastPolled    time.Time `json:"last_polled,omitzero"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitzero"`
+}
+
+// handleStatus lists the tracked matches along with when each was last polled
+// and the last error seen for it.
+func (a *app) handleStatus(w http.ResponseWriter, r *http.Request) {
+	resp := statusResponse{Leader: a.isLeader(), Matches: []matchStatus{}}
+	a.matchMutex.Lock()
+	for _, m := range a.matches {
+		resp.Matches = append(resp.Matches, matchStatus{
+			MatchID:       m.MatchId,
+			CompetitionID: m.CompetitionId,
+			HomeTeam:      m.HomeTeamAbbrev,
+			AwayTeam:      m.AwayTeamAbbrev,
+			Events:        len(m.Events),
+		})
+	}
+	a.matchMutex.Unlock()
+
+	a.health.mu.Lock()
+	resp.Started = a.health.started
+	resp.LastPoll = a.health.lastPoll
+	resp.LastPollError = a.redactor.Redact(a.health.lastPollError)
+	resp.LastPollErrorAt = a.health.lastPollErrorAt
+	resp.LastNotification = a.health.lastSend
+	resp.LastNotificationError = a.redactor.Redact(a.health.lastSendError)
+	for i, m := range resp.Matches {
+		h := a.health.matches[m.MatchID]
+		resp.Matches[i].LastPolled = h.lastPolled
+		resp.Matches[i].LastError = a.redactor.Redact(h.lastError)
+		resp.Matches[i].LastErrorAt = h.lastErrorAt
+	}
+	a.health.mu.Unlock()
+
+	slices.SortFunc(resp.Matches, func(x, y matchStatus) int {
+		return strings.Compare(x.MatchID, y.MatchID)
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write response", "error", err)
+	}
+}
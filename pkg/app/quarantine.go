@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/imdevinc/fifa-bot/pkg/database"
+	"github.com/imdevinc/fifa-bot/pkg/fifa"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+// ErrNoQuarantine is returned when listing or deleting unknown events with
+// storage that does not quarantine them.
+var ErrNoQuarantine = errors.New("storage does not quarantine unknown events")
+
+// CustomEventsFromConfig returns the top-level custom events defined in cfg.
+// Entries that fail to parse are left out, Validate reports them.
+func CustomEventsFromConfig(cfg *Config) fifa.CustomEvents {
+	return customEvents(cfg.CustomEvents)
+}
+
+func customEvents(configs []CustomEventConfig) fifa.CustomEvents {
+	custom := make(fifa.CustomEvents, len(configs))
+	for _, ce := range configs {
+		c, err := fifa.NewCustomEvent(ce.Name, ce.Icon, ce.Template)
+		if err != nil {
+			continue
+		}
+		custom[go_fifa.MatchEvent(ce.Type)] = c
+	}
+	return custom
+}
+
+// quarantineEvent keeps an unknown event with its full JSON, so its type can
+// be looked into and mapped in custom_events.
+func (a *app) quarantineEvent(ctx context.Context, match *models.Match, evt go_fifa.TimelineEvent) {
+	q, ok := a.db.(database.Quarantine)
+	if !ok {
+		return
+	}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("failed to marshal unknown event to JSON", "matchId", match.MatchId, "eventId", evt.Id, "error", err)
+		return
+	}
+	err = q.QuarantineEvent(ctx, models.UnknownEvent{
+		MatchID:       match.MatchId,
+		CompetitionID: match.CompetitionId,
+		EventID:       evt.Id,
+		Type:          int(evt.Type),
+		Minute:        evt.MatchMinute,
+		Payload:       payload,
+		SeenAt:        a.now(),
+	})
+	if err != nil {
+		slog.Error("failed to quarantine unknown event", "matchId", match.MatchId, "eventId", evt.Id, "error", err)
+		a.captureError(componentStorage, "quarantine_event", match, err)
+	}
+}
+
+// UnknownEventTypes returns the quarantined events grouped by type code.
+func (a *app) UnknownEventTypes(ctx context.Context) ([]models.UnknownEventType, error) {
+	q, ok := a.db.(database.Quarantine)
+	if !ok {
+		return nil, ErrNoQuarantine
+	}
+	events, err := q.GetUnknownEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unknown events. %w", err)
+	}
+	return models.GroupUnknownEvents(events), nil
+}
+
+// DeleteUnknownEvents deletes the quarantined events of a type and returns
+// how many there were.
+func (a *app) DeleteUnknownEvents(ctx context.Context, eventType int) (int, error) {
+	q, ok := a.db.(database.Quarantine)
+	if !ok {
+		return 0, ErrNoQuarantine
+	}
+	deleted, err := q.DeleteUnknownEvents(ctx, eventType)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unknown events of type %d. %w", eventType, err)
+	}
+	slog.Info("unknown events deleted by admin", "eventType", eventType, "deleted", deleted)
+	return deleted, nil
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+// maxBreadcrumbs is how many recent events of a match are attached to what is
+// captured for it.
+const maxBreadcrumbs = 20
+
+// Components tag captured errors with the part of the bot that failed.
+const (
+	componentFIFA     = "fifa"
+	componentStorage  = "storage"
+	componentNotifier = "notifier"
+)
+
+func matchTags(match *models.Match) map[string]string {
+	return map[string]string{
+		"match_id":       match.MatchId,
+		"stage_id":       match.StageId,
+		"season_id":      match.SeasonId,
+		"competition_id": match.CompetitionId,
+		"home_team":      match.HomeTeamAbbrev,
+		"away_team":      match.AwayTeamAbbrev,
+	}
+}
+
+// addBreadcrumb remembers a processed event of the match, so later captures
+// for the match show what led up to them.
+func (a *app) addBreadcrumb(match *models.Match, evt go_fifa.TimelineEvent, outcome string) {
+	if !a.sentryEnabled {
+		return
+	}
+	crumb := &sentry.Breadcrumb{
+		Category: "event",
+		Message:  fmt.Sprintf("%s %s", a.settings().CustomEvents.Name(evt.Type), evt.MatchMinute),
+		Data: map[string]interface{}{
+			"event_id":   evt.Id,
+			"event_type": int(evt.Type),
+			"outcome":    outcome,
+		},
+		Level:     sentry.LevelInfo,
+		Timestamp: evt.Timestamp,
+	}
+	if crumb.Timestamp.IsZero() {
+		crumb.Timestamp = a.now()
+	}
+	a.matchMutex.Lock()
+	defer a.matchMutex.Unlock()
+	crumbs := append(a.breadcrumbs[match.MatchId], crumb)
+	if len(crumbs) > maxBreadcrumbs {
+		crumbs = crumbs[len(crumbs)-maxBreadcrumbs:]
+	}
+	a.breadcrumbs[match.MatchId] = crumbs
+}
+
+// sentryHub returns a hub for one capture, tagged with the match and carrying
+// its recent events when match is set. Matches are processed concurrently, so
+// each capture gets a scope of its own.
+func (a *app) sentryHub(match *models.Match) *sentry.Hub {
+	hub := sentry.CurrentHub().Clone()
+	if match == nil {
+		return hub
+	}
+	scope := hub.Scope()
+	scope.SetTags(matchTags(match))
+	a.matchMutex.Lock()
+	crumbs := slices.Clone(a.breadcrumbs[match.MatchId])
+	a.matchMutex.Unlock()
+	for _, crumb := range crumbs {
+		scope.AddBreadcrumb(crumb, maxBreadcrumbs)
+	}
+	return hub
+}
+
+// captureError reports an error to Sentry. Errors are grouped by the component
+// and operation that failed rather than by message, which names the match, so
+// an outage shows up as one issue.
+func (a *app) captureError(component string, operation string, match *models.Match, err error) {
+	if !a.sentryEnabled || err == nil {
+		return
+	}
+	hub := a.sentryHub(match)
+	scope := hub.Scope()
+	scope.SetTag("component", component)
+	scope.SetTag("operation", operation)
+	scope.SetFingerprint([]string{component, operation})
+	hub.CaptureException(err)
+}
+
+// captureUnknownEvent reports an event type the bot does not know. Events are
+// grouped by type code, so a new type is one issue however often it occurs.
+func (a *app) captureUnknownEvent(evt go_fifa.TimelineEvent, match *models.Match) {
+	eventJSON, err := json.Marshal(evt)
+	if err != nil {
+		slog.Error("failed to marshal unknown event to JSON", "error", err)
+		return
+	}
+
+	matchJSON, err := json.Marshal(match)
+	if err != nil {
+		slog.Error("failed to marshal match info to JSON", "error", err)
+		return
+	}
+
+	hub := a.sentryHub(match)
+	scope := hub.Scope()
+	scope.SetTag("event_type", strconv.Itoa(int(evt.Type)))
+	scope.SetFingerprint([]string{"unknown-event", strconv.Itoa(int(evt.Type))})
+	scope.SetExtra("full_event_json", string(eventJSON))
+	scope.SetExtra("match_info_json", string(matchJSON))
+	hub.CaptureMessage(fmt.Sprintf("Unknown event type: %d in match %s (%s vs %s)",
+		evt.Type, match.MatchId, match.HomeTeamAbbrev, match.AwayTeamAbbrev))
+}
+
+// captureRetiredMatch reports a match retired because FIFA stopped listing it
+// as live without it ending.
+func (a *app) captureRetiredMatch(match models.Match, missingFor string) {
+	if !a.sentryEnabled {
+		return
+	}
+	hub := a.sentryHub(&match)
+	scope := hub.Scope()
+	scope.SetLevel(sentry.LevelWarning)
+	scope.SetExtra("missing_for", missingFor)
+	hub.CaptureMessage(fmt.Sprintf("Retired stale match %s (%s vs %s) after it stopped being reported live",
+		match.MatchId, match.HomeTeamAbbrev, match.AwayTeamAbbrev))
+}
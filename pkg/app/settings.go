@@ -0,0 +1,62 @@
+package app
+
+import (
+	"maps"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/fifa"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+// Settings are the options that can be changed while the app runs. They are
+// swapped as a whole, so a poll never sees half of a change.
+type Settings struct {
+	// SlackWebhookURL changes when the secret file it is read from rotates.
+	SlackWebhookURL string
+	// CompetitionID, if set, limits the bot to matches of that competition.
+	CompetitionID   string
+	PollInterval    time.Duration
+	EventsToSkip    map[go_fifa.MatchEvent]bool
+	StaleMatchGrace time.Duration
+	// Tenants, if set, replace SlackWebhookURL, CompetitionID and
+	// EventsToSkip with a webhook, competitions and skip list per workspace.
+	Tenants []Tenant
+	// CustomEvents render event types the bot does not know.
+	CustomEvents fifa.CustomEvents
+}
+
+func (a *app) settings() *Settings {
+	return a.current.Load()
+}
+
+// Settings returns a copy of the settings in use.
+func (a *app) Settings() Settings {
+	s := *a.settings()
+	s.EventsToSkip = maps.Clone(s.EventsToSkip)
+	s.Tenants = cloneTenants(s.Tenants)
+	s.CustomEvents = maps.Clone(s.CustomEvents)
+	return s
+}
+
+// ApplySettings replaces the settings in use. The poll in progress finishes
+// with the old settings.
+func (a *app) ApplySettings(s Settings) {
+	s.EventsToSkip = maps.Clone(s.EventsToSkip)
+	s.Tenants = cloneTenants(s.Tenants)
+	s.CustomEvents = maps.Clone(s.CustomEvents)
+	if s.EventsToSkip == nil {
+		s.EventsToSkip = map[go_fifa.MatchEvent]bool{}
+	}
+	a.current.Store(&s)
+}
+
+func cloneTenants(tenants []Tenant) []Tenant {
+	if tenants == nil {
+		return nil
+	}
+	cloned := make([]Tenant, len(tenants))
+	for i, t := range tenants {
+		cloned[i] = t.clone()
+	}
+	return cloned
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/imdevinc/fifa-bot/pkg/fifa"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+// Tenant is a Slack workspace the bot posts to, with its own webhook,
+// competitions and skip list. Each match is polled once however many tenants
+// follow it.
+type Tenant struct {
+	// Name identifies the tenant in logs, metrics and notification history.
+	// It is empty for the single tenant of a config without tenants.
+	Name            string
+	SlackWebhookURL string
+	// Competitions limits the tenant to matches of these competitions. Empty
+	// means every competition.
+	Competitions []string
+	EventsToSkip map[go_fifa.MatchEvent]bool
+	// CustomEvents are the tenant's own custom events, which replace the
+	// top-level ones of the same type for this tenant.
+	CustomEvents fifa.CustomEvents
+	// Language picks the event descriptions from FIFA, such as "es" or
+	// "es-ES". Empty, or a language an event has no description in, uses
+	// the event's first description.
+	Language string
+}
+
+func (t Tenant) subscribed(competitionID string) bool {
+	return len(t.Competitions) == 0 || slices.Contains(t.Competitions, competitionID)
+}
+
+func (t Tenant) clone() Tenant {
+	t.Competitions = slices.Clone(t.Competitions)
+	t.EventsToSkip = maps.Clone(t.EventsToSkip)
+	t.CustomEvents = maps.Clone(t.CustomEvents)
+	return t
+}
+
+// render renders an event for the tenant when it needs its own rendering,
+// because it has its own custom event for the type or the event has a
+// description in its language, and reports whether it did. shared are the
+// top-level custom events.
+func (t Tenant) render(ctx context.Context, evt go_fifa.TimelineEvent, opts *models.Match, shared fifa.CustomEvents) (string, bool) {
+	evt, translated := localize(evt, t.Language)
+	_, own := t.CustomEvents[evt.Type]
+	if !own && !translated {
+		return "", false
+	}
+	events := shared
+	if len(t.CustomEvents) > 0 {
+		events = maps.Clone(shared)
+		if events == nil {
+			events = fifa.CustomEvents{}
+		}
+		maps.Copy(events, t.CustomEvents)
+	}
+	result := events.ProcessEvent(ctx, evt, opts, t.EventsToSkip)
+	if !own && result.IsUnknown {
+		return "", false
+	}
+	return result.SlackMessage, true
+}
+
+// localize moves the event's description in language to the front, where
+// rendering reads it, and reports whether it had to. A language such as "es"
+// also matches regional descriptions such as "es-ES".
+func localize(evt go_fifa.TimelineEvent, language string) (go_fifa.TimelineEvent, bool) {
+	if language == "" {
+		return evt, false
+	}
+	i := slices.IndexFunc(evt.Description, func(d go_fifa.LocaleDescription) bool {
+		return strings.EqualFold(d.Locale, language) || strings.HasPrefix(strings.ToLower(d.Locale), strings.ToLower(language)+"-")
+	})
+	if i <= 0 {
+		return evt, false
+	}
+	descriptions := make([]go_fifa.LocaleDescription, 0, len(evt.Description))
+	descriptions = append(descriptions, evt.Description[i])
+	descriptions = append(descriptions, evt.Description[:i]...)
+	evt.Description = append(descriptions, evt.Description[i+1:]...)
+	return evt, true
+}
+
+// tenants returns the workspaces to post to. Without configured tenants the
+// webhook and skip list form one unnamed tenant, which gets every tracked
+// match since CompetitionID already limits the matches picked up.
+func (s *Settings) tenants() []Tenant {
+	if len(s.Tenants) > 0 {
+		return s.Tenants
+	}
+	return []Tenant{{
+		SlackWebhookURL: s.SlackWebhookURL,
+		EventsToSkip:    s.EventsToSkip,
+	}}
+}
+
+// watches reports whether matches of the competition should be picked up from
+// FIFA's live matches.
+func (s *Settings) watches(competitionID string) bool {
+	if len(s.Tenants) == 0 {
+		return s.CompetitionID == "" || s.CompetitionID == competitionID
+	}
+	return slices.ContainsFunc(s.Tenants, func(t Tenant) bool { return t.subscribed(competitionID) })
+}
+
+// recipients returns the tenants following the match that do not skip the
+// event type.
+func (s *Settings) recipients(competitionID string, eventType go_fifa.MatchEvent) []Tenant {
+	var recipients []Tenant
+	for _, t := range s.tenants() {
+		if t.subscribed(competitionID) && !t.EventsToSkip[eventType] {
+			recipients = append(recipients, t)
+		}
+	}
+	return recipients
+}
+
+// skippedByAll returns the event types every tenant following the competition
+// skips, which are not rendered at all.
+func (s *Settings) skippedByAll(competitionID string) map[go_fifa.MatchEvent]bool {
+	var skipped map[go_fifa.MatchEvent]bool
+	first := true
+	for _, t := range s.tenants() {
+		if !t.subscribed(competitionID) {
+			continue
+		}
+		if first {
+			skipped = maps.Clone(t.EventsToSkip)
+			first = false
+			continue
+		}
+		maps.DeleteFunc(skipped, func(evt go_fifa.MatchEvent, skip bool) bool { return !t.EventsToSkip[evt] })
+	}
+	return skipped
+}
+
+// TenantsFromConfig returns the tenants defined in cfg. The top-level
+// skip_events are skipped for every tenant on top of its own. Unknown event
+// names and custom events that fail to parse are left out, Validate reports
+// them.
+func TenantsFromConfig(cfg *Config) []Tenant {
+	tenants := make([]Tenant, 0, len(cfg.Tenants))
+	custom := CustomEventsFromConfig(cfg)
+	for _, tc := range cfg.Tenants {
+		own := customEvents(tc.CustomEvents)
+		// Skip lists may name the tenant's own custom events too
+		names := maps.Clone(custom)
+		maps.Copy(names, own)
+		skipSet, _ := fifa.ParseEventNamesWith(slices.Concat(cfg.SkipEvents, tc.SkipEvents), names)
+		tenants = append(tenants, Tenant{
+			Name:            tc.Name,
+			SlackWebhookURL: tc.SlackWebhookURL,
+			Competitions:    slices.Clone(tc.Competitions),
+			EventsToSkip:    skipSet,
+			CustomEvents:    own,
+			Language:        tc.Language,
+		})
+	}
+	return tenants
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/imdevinc/fifa-bot/pkg/app")
+
+func matchAttributes(match *models.Match) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("match.id", match.MatchId),
+		attribute.String("match.competition_id", match.CompetitionId),
+		attribute.String("match.home_team", match.HomeTeamAbbrev),
+		attribute.String("match.away_team", match.AwayTeamAbbrev),
+	}
+}
+
+func eventAttributes(evt message) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("event.id", evt.eventID),
+		attribute.String("event.type", evt.eventType),
+	}
+}
+
+// failSpan marks the span failed with err, with its secrets redacted since
+// spans are exported.
+func (a *app) failSpan(span trace.Span, err error) {
+	err = errors.New(a.redactor.Redact(err.Error()))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endSpan marks the span failed if err is set and ends it.
+func (a *app) endSpan(span trace.Span, err error) {
+	if err != nil {
+		a.failSpan(span, err)
+	}
+	span.End()
+}
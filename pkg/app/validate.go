@@ -0,0 +1,311 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/imdevinc/fifa-bot/pkg/fifa"
+)
+
+// ConfigError lists every problem found while validating a config.
+type ConfigError struct {
+	Problems []string
+	// Warnings are the warnings found alongside the problems, when they were
+	// not counted as problems.
+	Warnings []string
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid config: " + e.Problems[0]
+	}
+	return fmt.Sprintf("invalid config, %d problems: %s", len(e.Problems), strings.Join(e.Problems, "; "))
+}
+
+// Validate checks the whole config and reports every problem at once.
+// Settings that are probably mistakes but still usable are returned as
+// warnings, and count as problems when strict is set.
+func (cfg *Config) Validate(strict bool) (warnings []string, err error) {
+	var problems []string
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	customNames := make([]string, len(cfg.CustomEvents))
+	for i, ce := range cfg.CustomEvents {
+		customNames[i] = ce.Name
+	}
+	// checkCustomEvents checks a custom_events list. inherited are the
+	// custom events a tenant's list adds to, which it may only reuse the
+	// names of to replace them.
+	checkCustomEvents := func(field string, events []CustomEventConfig, inherited []CustomEventConfig) {
+		types := map[int]bool{}
+		names := map[string]bool{}
+		for i, ce := range events {
+			field := fmt.Sprintf("%s[%d]", field, i)
+			switch {
+			case ce.Type < 1:
+				problemf("%s.type must be a FIFA event type code such as 99, got %d", field, ce.Type)
+			case types[ce.Type]:
+				problemf("%s.type %d is mapped by another custom event", field, ce.Type)
+			}
+			types[ce.Type] = true
+			switch {
+			case !customEventNamePattern.MatchString(ce.Name):
+				problemf("%s.name must be letters and digits starting with a letter, such as \"VARReview\", got %q", field, ce.Name)
+			case slices.Contains(fifa.EventNames(), ce.Name):
+				problemf("%s.name %q is the name of a built-in event", field, ce.Name)
+			case names[ce.Name], slices.ContainsFunc(inherited, func(other CustomEventConfig) bool {
+				return other.Name == ce.Name && other.Type != ce.Type
+			}):
+				problemf("%s.name %q is used by another custom event", field, ce.Name)
+			}
+			names[ce.Name] = true
+			if _, err := fifa.NewCustomEvent(ce.Name, ce.Icon, ce.Template); err != nil {
+				problemf("%s.template is invalid, %s", field, err)
+			}
+		}
+	}
+
+	var missing []string
+	if cfg.SlackWebhookURL == "" && len(cfg.Tenants) == 0 && !cfg.DryRun {
+		missing = append(missing, "slack_webhook_url or slack_webhook_url_file")
+	}
+	// HA and shard modes coordinate through Redis whatever the storage backend is
+	usesRedis := cfg.Storage == StorageRedis || cfg.HA.Enabled || cfg.Shard.Enabled
+	if usesRedis && cfg.Redis.Address == "" {
+		missing = append(missing, "redis.address")
+	}
+	if cfg.Storage == StoragePostgres && cfg.Postgres.URL == "" {
+		missing = append(missing, "postgres.url")
+	}
+	if len(missing) > 0 {
+		problemf("required config fields are missing: %s", strings.Join(missing, ", "))
+	}
+
+	checkWebhook := func(field string, webhookURL string) {
+		if webhookURL == "" {
+			return
+		}
+		u, err := url.Parse(webhookURL)
+		switch {
+		case err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http"):
+			problemf("%s must be an absolute http or https URL such as https://hooks.slack.com/services/..., got %q", field, webhookURL)
+		case u.Scheme == "http":
+			warnf("%s uses http, the webhook is sent in plain text", field)
+		}
+	}
+	checkCompetition := func(field string, competitionID string) {
+		if _, err := strconv.ParseUint(competitionID, 10, 64); err != nil {
+			problemf("%s must be a numeric FIFA competition ID such as \"17\", got %q", field, competitionID)
+		}
+	}
+
+	checkWebhook("slack_webhook_url", cfg.SlackWebhookURL)
+	if cfg.CompetitionID != "" {
+		checkCompetition("competition_id", cfg.CompetitionID)
+	}
+
+	if len(cfg.Tenants) > 0 {
+		if cfg.SlackWebhookURL != "" {
+			problemf("slack_webhook_url cannot be combined with tenants, set slack_webhook_url on each tenant")
+		}
+		if cfg.CompetitionID != "" {
+			problemf("competition_id cannot be combined with tenants, set competitions on each tenant")
+		}
+	}
+	names := map[string]bool{}
+	for i, tenant := range cfg.Tenants {
+		field := fmt.Sprintf("tenants[%d]", i)
+		if !tenantNamePattern.MatchString(tenant.Name) {
+			problemf("%s.name must be lowercase letters, digits, - or _, such as \"acme\", got %q", field, tenant.Name)
+		} else if names[tenant.Name] {
+			problemf("%s.name %q is used by another tenant", field, tenant.Name)
+		} else {
+			field = fmt.Sprintf("tenants[%s]", tenant.Name)
+		}
+		names[tenant.Name] = true
+		if tenant.SlackWebhookURL == "" && !cfg.DryRun {
+			problemf("%s.slack_webhook_url or %s.slack_webhook_url_file is required", field, field)
+		}
+		checkWebhook(field+".slack_webhook_url", tenant.SlackWebhookURL)
+		for _, competitionID := range tenant.Competitions {
+			checkCompetition(field+".competitions", competitionID)
+		}
+		if tenant.Language != "" && !languagePattern.MatchString(tenant.Language) {
+			problemf("%s.language must be a language code such as \"es\" or \"es-ES\", got %q", field, tenant.Language)
+		}
+		checkCustomEvents(field+".custom_events", tenant.CustomEvents, cfg.CustomEvents)
+		tenantNames := slices.Clone(customNames)
+		for _, ce := range tenant.CustomEvents {
+			tenantNames = append(tenantNames, ce.Name)
+		}
+		warnings = append(warnings, skipEventWarnings(field+".skip_events", tenant.SkipEvents, tenantNames)...)
+	}
+
+	if cfg.SleepTimeSeconds < 1 {
+		problemf("sleep_time_seconds must be at least 1, got %d", cfg.SleepTimeSeconds)
+	} else if cfg.SleepTimeSeconds < 10 {
+		warnf("sleep_time_seconds is %d, polling FIFA more often than every 10 seconds may get the bot rate limited", cfg.SleepTimeSeconds)
+	}
+
+	switch cfg.Storage {
+	case StorageRedis, StorageMemory, StorageBolt, StoragePostgres:
+	default:
+		problemf("unknown storage %q, expected one of %s, %s, %s, %s", cfg.Storage, StorageRedis, StorageBolt, StoragePostgres, StorageMemory)
+	}
+
+	if cfg.HA.Enabled && (cfg.Storage == StorageMemory || cfg.Storage == StorageBolt) {
+		problemf("ha.enabled requires storage shared between instances, %s cannot be shared", cfg.Storage)
+	}
+	if cfg.Shard.Enabled && (cfg.Storage == StorageMemory || cfg.Storage == StorageBolt) {
+		problemf("shard.enabled requires storage shared between workers, %s cannot be shared", cfg.Storage)
+	}
+	if cfg.HA.Enabled && cfg.Shard.Enabled {
+		problemf("ha.enabled and shard.enabled cannot both be set, sharded workers already take over each other's matches")
+	}
+	if cfg.HA.Enabled && cfg.HA.LeaseTTLSeconds < 3 {
+		problemf("ha.lease_ttl_seconds must be at least 3, got %d", cfg.HA.LeaseTTLSeconds)
+	}
+	if cfg.Shard.Enabled && cfg.Shard.HeartbeatTTLSeconds < 3 {
+		problemf("shard.heartbeat_ttl_seconds must be at least 3, got %d", cfg.Shard.HeartbeatTTLSeconds)
+	}
+
+	if cfg.MatchTTLHours < 1 {
+		problemf("match_ttl_hours must be at least 1, got %d", cfg.MatchTTLHours)
+	}
+	if cfg.StaleMatchGraceMinutes < 1 {
+		problemf("stale_match_grace_minutes must be at least 1, got %d", cfg.StaleMatchGraceMinutes)
+	}
+
+	if usesRedis && cfg.Redis.Address != "" {
+		if _, _, err := net.SplitHostPort(cfg.Redis.Address); err != nil {
+			problemf("redis.address must be host:port such as localhost:6379, got %q", cfg.Redis.Address)
+		}
+	}
+	if ns := cfg.Redis.Namespace; ns == "match" || strings.HasPrefix(ns, "match:") {
+		// Its keys would be taken for keys written without a namespace,
+		// which migrate_unprefixed_keys moves
+		problemf("redis.namespace cannot be \"match\" or start with \"match:\", got %q", ns)
+	} else if strings.ContainsAny(ns, "*?[]\\") {
+		problemf("redis.namespace cannot contain *, ?, [, ] or \\ as keys are scanned by pattern, got %q", ns)
+	}
+	if cfg.Redis.Database < 0 {
+		problemf("redis.database must not be negative, got %d", cfg.Redis.Database)
+	}
+
+	if cfg.Storage == StoragePostgres && strings.Contains(cfg.Postgres.URL, "://") {
+		// Key/value connection strings such as "host=db user=bot" are accepted
+		// as they are
+		u, err := url.Parse(cfg.Postgres.URL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			problemf("postgres.url must be a postgres:// URL or a key/value connection string, got %q", redactURL(cfg.Postgres.URL))
+		}
+	}
+
+	if cfg.Tracing.Enabled {
+		if strings.Contains(cfg.Tracing.Endpoint, "://") {
+			u, err := url.Parse(cfg.Tracing.Endpoint)
+			if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+				problemf("tracing.endpoint must be host:port or an http or https URL, got %q", cfg.Tracing.Endpoint)
+			}
+		} else if _, _, err := net.SplitHostPort(cfg.Tracing.Endpoint); err != nil {
+			problemf("tracing.endpoint must be host:port or an http or https URL, got %q", cfg.Tracing.Endpoint)
+		}
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		problemf("tracing.sample_ratio must be between 0 and 1, got %g", cfg.Tracing.SampleRatio)
+	}
+
+	if cfg.EnableProfiling && (cfg.ProfilingPort < 1 || cfg.ProfilingPort > 65535) {
+		problemf("profiling_port must be between 1 and 65535, got %d", cfg.ProfilingPort)
+	}
+	if cfg.EnableOpsServer && (cfg.OpsPort < 1 || cfg.OpsPort > 65535) {
+		problemf("ops_port must be between 1 and 65535, got %d", cfg.OpsPort)
+	}
+	if cfg.EnableProfiling && cfg.EnableOpsServer && cfg.ProfilingPort == cfg.OpsPort {
+		problemf("profiling_port and ops_port are both %d, the servers need different ports", cfg.OpsPort)
+	}
+
+	if cfg.AdminToken != "" && !cfg.EnableOpsServer {
+		problemf("admin_token requires enable_ops_server, the admin API is served on the ops server")
+	}
+	if cfg.AdminToken != "" && len(cfg.AdminToken) < 16 {
+		warnf("admin_token is %d characters, use at least 16", len(cfg.AdminToken))
+	}
+
+	if cfg.SentryDSN != "" {
+		u, err := url.Parse(cfg.SentryDSN)
+		if err != nil || u.Host == "" || u.User == nil || (u.Scheme != "https" && u.Scheme != "http") {
+			problemf("sentry_dsn must be a DSN such as https://<key>@o0.ingest.sentry.io/<project>, as shown in the Sentry project settings")
+		}
+	}
+
+	checkCustomEvents("custom_events", cfg.CustomEvents, nil)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		warnf("unknown log_level %q, INFO is used, expected one of DEBUG, INFO, WARN, ERROR", cfg.LogLevel)
+	}
+
+	warnings = append(warnings, skipEventWarnings("skip_events", cfg.SkipEvents, customNames)...)
+
+	if strict {
+		problems = append(problems, warnings...)
+		warnings = nil
+	}
+	if len(problems) > 0 {
+		return warnings, &ConfigError{Problems: problems, Warnings: warnings}
+	}
+	return warnings, nil
+}
+
+// tenantNamePattern is what a tenant name may look like. Names end up in
+// metric labels and notification history.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// languagePattern is what a tenant language may look like, matching the
+// locales of FIFA's descriptions.
+var languagePattern = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+
+// customEventNamePattern is what a custom event name may look like, in the
+// style of the built-in names.
+var customEventNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// skipEventWarnings names each entry of a skip list that is not an event name,
+// with the name it most likely meant.
+func skipEventWarnings(field string, skipEvents []string, customNames []string) []string {
+	names := slices.Concat(fifa.EventNames(), customNames)
+	var warnings []string
+	for _, entry := range skipEvents {
+		name := strings.TrimSpace(entry)
+		if slices.Contains(names, name) {
+			continue
+		}
+		idx := slices.IndexFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+		if idx >= 0 {
+			warnings = append(warnings, fmt.Sprintf("unknown event name %q in %s, did you mean %q?", entry, field, names[idx]))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("unknown event name %q in %s, expected one of %s", entry, field, strings.Join(names, ", ")))
+	}
+	return warnings
+}
+
+// redactURL hides the password of a URL so it can be shown in errors.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<unparseable URL>"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,461 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltMatchesBucket = []byte("matches")
+
+// boltUnknownEventsBucket holds quarantined events keyed by match and event ID.
+var boltUnknownEventsBucket = []byte("unknown_events")
+
+// boltControlsBucket holds the admin controls that are on, keyed by
+// models.Control.Key.
+var boltControlsBucket = []byte("controls")
+
+// boltRecord is the value stored per match. Fields holds the same flattened
+// representation that is written to the Redis hash, so both backends decode
+// matches with models.MatchFromRedis.
+type boltRecord struct {
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	// Events holds the encoded models.EventRecord of each processed event.
+	Events []json.RawMessage `json:"events,omitempty"`
+}
+
+type boltClient struct {
+	db  *bolt.DB
+	ttl time.Duration
+	now func() time.Time
+}
+
+var _ Database = (*boltClient)(nil)
+var _ Validator = (*boltClient)(nil)
+var _ Quarantine = (*boltClient)(nil)
+
+// NewBoltClient opens, or creates, a single-file database at path. Only one
+// process can hold the file open at a time.
+func NewBoltClient(path string) (*boltClient, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file %s. %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltMatchesBucket, boltUnknownEventsBucket, boltControlsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets. %w", err)
+	}
+	return &boltClient{
+		db:  db,
+		ttl: DefaultMatchTTL,
+		now: time.Now,
+	}, nil
+}
+
+func (b *boltClient) Close() error {
+	return b.db.Close()
+}
+
+// SetMatchTTL sets how long a match is kept after it was last added or
+// updated.
+func (b *boltClient) SetMatchTTL(ttl time.Duration) {
+	b.ttl = ttl
+}
+
+func (b *boltClient) AddMatch(ctx context.Context, match models.Match) error {
+	fields, err := matchFields(match)
+	if err != nil {
+		return fmt.Errorf("failed to format match. %w", err)
+	}
+	record := boltRecord{Fields: fields, ExpiresAt: b.now().Add(b.ttl)}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return putRecord(tx, match.MatchId, record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save match to database file. %w", err)
+	}
+	return nil
+}
+
+func (b *boltClient) GetMatch(ctx context.Context, matchID string) (models.Match, error) {
+	var record boltRecord
+	var found bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, found, err = b.getRecord(tx, matchID)
+		return err
+	})
+	if err != nil {
+		return models.Match{}, fmt.Errorf("failed to get match %s from database. %w", matchID, err)
+	}
+	if !found {
+		return models.Match{}, ErrMatchNotFound
+	}
+	match, err := models.MatchFromRedis(record.Fields)
+	if err != nil {
+		return models.Match{}, fmt.Errorf("failed to unmarshal match. %w", err)
+	}
+	return match, nil
+}
+
+func (b *boltClient) DeleteMatch(ctx context.Context, matchID string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMatchesBucket).Delete([]byte(matchID))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete from database file. %w", err)
+	}
+	return nil
+}
+
+// UpdateMatch pushes the expiry back and keeps any events already claimed,
+// matching the Redis backend.
+func (b *boltClient) UpdateMatch(ctx context.Context, match models.Match) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		record, found, err := b.getRecord(tx, match.MatchId)
+		if err != nil {
+			return err
+		}
+		if found {
+			existing, err := models.MatchFromRedis(record.Fields)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal match %s. %w", match.MatchId, err)
+			}
+			match.Events = mergeEvents(slices.Clone(match.Events), existing.Events)
+		}
+		record.Fields, err = matchFields(match)
+		if err != nil {
+			return fmt.Errorf("failed to format match. %w", err)
+		}
+		record.ExpiresAt = b.now().Add(b.ttl)
+		return putRecord(tx, match.MatchId, record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update events in database file. %w", err)
+	}
+	return nil
+}
+
+func (b *boltClient) ClaimEvent(ctx context.Context, matchID string, eventID string) (bool, error) {
+	claimed := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		record, found, err := b.getRecord(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrMatchNotFound
+		}
+		match, err := models.MatchFromRedis(record.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal match %s. %w", matchID, err)
+		}
+		if slices.Contains(match.Events, eventID) {
+			return nil
+		}
+		match.Events = append(match.Events, eventID)
+		record.Fields, err = matchFields(match)
+		if err != nil {
+			return err
+		}
+		claimed = true
+		return putRecord(tx, matchID, record)
+	})
+	if errors.Is(err, ErrMatchNotFound) {
+		return false, err
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event %s for match %s. %w", eventID, matchID, err)
+	}
+	return claimed, nil
+}
+
+func (b *boltClient) ResetMatch(ctx context.Context, matchID string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		record, found, err := b.getRecord(tx, matchID)
+		if err != nil || !found {
+			return err
+		}
+		match, err := models.MatchFromRedis(record.Fields)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal match %s. %w", matchID, err)
+		}
+		match.Events = nil
+		record.Fields, err = matchFields(match)
+		if err != nil {
+			return err
+		}
+		record.Events = nil
+		return putRecord(tx, matchID, record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset match %s. %w", matchID, err)
+	}
+	return nil
+}
+
+func (b *boltClient) RecordEvent(ctx context.Context, matchID string, event models.EventRecord) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		record, found, err := b.getRecord(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrMatchNotFound
+		}
+		events, err := decodeEventRecords(record.Events)
+		if err != nil {
+			return err
+		}
+		events = putEventRecord(events, event)
+		record.Events = make([]json.RawMessage, len(events))
+		for i, e := range events {
+			if record.Events[i], err = e.Encode(); err != nil {
+				return err
+			}
+		}
+		return putRecord(tx, matchID, record)
+	})
+	if errors.Is(err, ErrMatchNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record event %s for match %s. %w", event.EventID, matchID, err)
+	}
+	return nil
+}
+
+func (b *boltClient) GetEventRecords(ctx context.Context, matchID string) ([]models.EventRecord, error) {
+	var events []models.EventRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		record, _, err := b.getRecord(tx, matchID)
+		if err != nil {
+			return err
+		}
+		events, err = decodeEventRecords(record.Events)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event records for match %s. %w", matchID, err)
+	}
+	return sortEventRecords(events), nil
+}
+
+func decodeEventRecords(data []json.RawMessage) ([]models.EventRecord, error) {
+	events := make([]models.EventRecord, 0, len(data))
+	for _, d := range data {
+		e, err := models.DecodeEventRecord(d)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (b *boltClient) SetControl(ctx context.Context, control models.Control, matchID string, on bool) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltControlsBucket)
+		if !on {
+			return bucket.Delete([]byte(control.Key(matchID)))
+		}
+		return bucket.Put([]byte(control.Key(matchID)), []byte{})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set %s control for match %q. %w", control, matchID, err)
+	}
+	return nil
+}
+
+func (b *boltClient) GetControls(ctx context.Context) (models.Controls, error) {
+	controls := models.Controls{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltControlsBucket).ForEach(func(k, v []byte) error {
+			control, matchID, err := models.ParseControlKey(string(k))
+			if err != nil {
+				return err
+			}
+			controls.Set(control, matchID, true)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get controls. %w", err)
+	}
+	return controls, nil
+}
+
+func (b *boltClient) QuarantineEvent(ctx context.Context, event models.UnknownEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal unknown event %s. %w", event.EventID, err)
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUnknownEventsBucket).Put([]byte(event.MatchID+"/"+event.EventID), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to quarantine event %s for match %s. %w", event.EventID, event.MatchID, err)
+	}
+	return nil
+}
+
+func (b *boltClient) GetUnknownEvents(ctx context.Context) ([]models.UnknownEvent, error) {
+	var events []models.UnknownEvent
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUnknownEventsBucket).ForEach(func(k, v []byte) error {
+			var e models.UnknownEvent
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal unknown event %s. %w", k, err)
+			}
+			events = append(events, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unknown events. %w", err)
+	}
+	return sortUnknownEvents(events), nil
+}
+
+func (b *boltClient) DeleteUnknownEvents(ctx context.Context, eventType int) (int, error) {
+	deleted := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltUnknownEventsBucket)
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var e models.UnknownEvent
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to unmarshal unknown event %s. %w", k, err)
+			}
+			if e.Type == eventType {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Keys are deleted after the walk, as bolt does not allow changing a
+		// bucket while iterating over it
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unknown events of type %d. %w", eventType, err)
+	}
+	return deleted, nil
+}
+
+func (b *boltClient) GetAllMatches(ctx context.Context) ([]models.Match, error) {
+	matches, _, err := b.loadAllMatches()
+	if err != nil {
+		return []models.Match{}, err
+	}
+	return matches, nil
+}
+
+func (b *boltClient) ValidateMatches(ctx context.Context) ([]InvalidMatch, error) {
+	_, invalid, err := b.loadAllMatches()
+	return invalid, err
+}
+
+// loadAllMatches decodes every unexpired match and deletes expired ones.
+func (b *boltClient) loadAllMatches() ([]models.Match, []InvalidMatch, error) {
+	matches := []models.Match{}
+	invalid := []InvalidMatch{}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltMatchesBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record boltRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				invalid = append(invalid, InvalidMatch{MatchID: string(k), Err: err})
+				return nil
+			}
+			if b.expired(record) {
+				expired = append(expired, k)
+				return nil
+			}
+			match, err := models.MatchFromRedis(record.Fields)
+			if err != nil {
+				invalid = append(invalid, InvalidMatch{MatchID: string(k), Err: err})
+				return nil
+			}
+			matches = append(matches, match)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get matches from database file. %w", err)
+	}
+	return matches, invalid, nil
+}
+
+func (b *boltClient) getRecord(tx *bolt.Tx, matchID string) (boltRecord, bool, error) {
+	data := tx.Bucket(boltMatchesBucket).Get([]byte(matchID))
+	if data == nil {
+		return boltRecord{}, false, nil
+	}
+	var record boltRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return boltRecord{}, false, fmt.Errorf("failed to unmarshal match %s. %w", matchID, err)
+	}
+	if b.expired(record) {
+		return boltRecord{}, false, nil
+	}
+	return record, true, nil
+}
+
+func (b *boltClient) expired(record boltRecord) bool {
+	return !record.ExpiresAt.IsZero() && !b.now().Before(record.ExpiresAt)
+}
+
+func putRecord(tx *bolt.Tx, matchID string, record boltRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltMatchesBucket).Put([]byte(matchID), data)
+}
+
+// matchFields flattens a match into the string fields stored in a Redis hash.
+func matchFields(match models.Match) (map[string]string, error) {
+	data, err := match.GetMap()
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(data))
+	for k, v := range data {
+		fields[k] = fmt.Sprint(v)
+	}
+	return fields, nil
+}
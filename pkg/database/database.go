@@ -3,16 +3,83 @@ package database
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/imdevinc/fifa-bot/pkg/models"
 )
 
 var ErrMatchNotFound = errors.New("match not found")
 
+// DefaultMatchTTL is how long a match is kept after it was last added or
+// updated, unless a backend is given another with SetMatchTTL.
+const DefaultMatchTTL = 24 * time.Hour
+
 type Database interface {
 	AddMatch(ctx context.Context, match models.Match) error
 	GetMatch(ctx context.Context, matchID string) (models.Match, error)
 	DeleteMatch(ctx context.Context, matchID string) error
 	UpdateMatch(ctx context.Context, match models.Match) error
+	// GetAllMatches returns every stored match. Records that cannot be
+	// decoded are left out, see Validator.
 	GetAllMatches(ctx context.Context) ([]models.Match, error)
+	// ClaimEvent marks an event as processed for a match. It returns true only
+	// for the first caller to claim the event, so an event is announced once
+	// even when several workers race on it.
+	ClaimEvent(ctx context.Context, matchID string, eventID string) (bool, error)
+	// RecordEvent stores what was processed for an event, replacing any
+	// earlier record of the same event. Records live as long as the match.
+	RecordEvent(ctx context.Context, matchID string, event models.EventRecord) error
+	// GetEventRecords returns the recorded events of a match in the order they
+	// happened.
+	GetEventRecords(ctx context.Context, matchID string) ([]models.EventRecord, error)
+	// ResetMatch forgets every event claimed or recorded for a match, so its
+	// events can be claimed again. The match itself is kept.
+	ResetMatch(ctx context.Context, matchID string) error
+	// SetControl turns an admin control on or off for a match, or for every
+	// match when matchID is empty. Controls do not expire and are kept when
+	// their match is deleted, until they are turned off.
+	SetControl(ctx context.Context, control models.Control, matchID string, on bool) error
+	// GetControls returns every control that is on.
+	GetControls(ctx context.Context) (models.Controls, error)
+}
+
+// InvalidMatch is a stored match record that could not be decoded.
+type InvalidMatch struct {
+	MatchID string
+	Err     error
+}
+
+// Validator is implemented by backends that store matches in a serialized
+// layout, which older or newer versions of the bot may have written
+// differently.
+type Validator interface {
+	// ValidateMatches decodes every stored match and returns the ones that
+	// fail.
+	ValidateMatches(ctx context.Context) ([]InvalidMatch, error)
+}
+
+// Pinger is implemented by backends that talk to a server, so readiness checks
+// can tell whether it is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// History is implemented by backends that keep a permanent record of each
+// notification sent for a match, on top of its events.
+type History interface {
+	RecordNotification(ctx context.Context, matchID string, eventID string, destination string, sendErr error) error
+}
+
+// Quarantine is implemented by backends that keep the events of types the bot
+// does not know, with their full JSON. Quarantined events are kept after their
+// match expires, until they are deleted.
+type Quarantine interface {
+	// QuarantineEvent stores an unknown event, replacing any earlier copy of
+	// the same event.
+	QuarantineEvent(ctx context.Context, event models.UnknownEvent) error
+	// GetUnknownEvents returns every quarantined event, oldest first.
+	GetUnknownEvents(ctx context.Context) ([]models.UnknownEvent, error)
+	// DeleteUnknownEvents deletes the quarantined events of a type, such as
+	// once it is mapped in custom_events, and returns how many there were.
+	DeleteUnknownEvents(ctx context.Context, eventType int) (int, error)
 }
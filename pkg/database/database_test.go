@@ -0,0 +1,717 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// backend is a Database under test along with a way to move its clock
+// forward, so expiry can be checked without sleeping.
+type backend struct {
+	db          Database
+	fastForward func(time.Duration)
+}
+
+var backends = map[string]func(t *testing.T) backend{
+	"redis": func(t *testing.T) backend {
+		mr := miniredis.RunT(t)
+		db := NewRedisClient(mr.Addr(), "", 0, "")
+		t.Cleanup(func() { db.client.Close() })
+		return backend{db: db, fastForward: mr.FastForward}
+	},
+	"redis_namespaced": func(t *testing.T) backend {
+		mr := miniredis.RunT(t)
+		db := NewRedisClient(mr.Addr(), "", 0, "staging")
+		t.Cleanup(func() { db.client.Close() })
+		return backend{db: db, fastForward: mr.FastForward}
+	},
+	"bolt": func(t *testing.T) backend {
+		db, err := NewBoltClient(filepath.Join(t.TempDir(), "fifa-bot.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		now := time.Now()
+		db.now = func() time.Time { return now }
+		return backend{db: db, fastForward: func(d time.Duration) { now = now.Add(d) }}
+	},
+	"memory": func(t *testing.T) backend {
+		db := NewMemoryClient()
+		now := time.Now()
+		db.now = func() time.Time { return now }
+		return backend{db: db, fastForward: func(d time.Duration) { now = now.Add(d) }}
+	},
+}
+
+// postgresTestURL points at a scratch database used by the Postgres tests.
+// They are skipped when it is not set. Every table is truncated between tests.
+var postgresTestURL = os.Getenv("POSTGRES_TEST_URL")
+
+func init() {
+	if postgresTestURL == "" {
+		return
+	}
+	backends["postgres"] = func(t *testing.T) backend {
+		db := newPostgresTestClient(t)
+		now := time.Now()
+		db.now = func() time.Time { return now }
+		return backend{db: db, fastForward: func(d time.Duration) { now = now.Add(d) }}
+	}
+}
+
+func newPostgresTestClient(t *testing.T) *postgresClient {
+	if postgresTestURL == "" {
+		t.Skip("POSTGRES_TEST_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := NewPostgresClient(ctx, postgresTestURL)
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	_, err = db.pool.Exec(ctx, "TRUNCATE matches, match_events, notifications, unknown_events, admin_controls")
+	require.NoError(t, err)
+	return db
+}
+
+func testMatch(id string) models.Match {
+	return models.Match{
+		Events:         []string{},
+		CompetitionId:  "17",
+		SeasonId:       "285023",
+		StageId:        "289287",
+		MatchId:        id,
+		LastEvent:      "-1",
+		HomeTeamID:     "43971",
+		AwayTeamID:     "43926",
+		HomeTeamName:   "Argentina",
+		AwayTeamName:   "Egypt",
+		HomeTeamAbbrev: "ARG",
+		AwayTeamAbbrev: "EGY",
+	}
+}
+
+func TestDatabaseConformance(t *testing.T) {
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range conformanceTests {
+				t.Run(tc.name, func(t *testing.T) {
+					tc.run(t, newBackend(t))
+				})
+			}
+		})
+	}
+}
+
+var conformanceTests = []struct {
+	name string
+	run  func(t *testing.T, b backend)
+}{
+	{"AddAndGet", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		match := testMatch("1")
+		require.NoError(t, b.db.AddMatch(ctx, match))
+		got, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, match, got)
+	}},
+	{"GetMissing", func(t *testing.T, b backend) {
+		_, err := b.db.GetMatch(context.Background(), "missing")
+		assert.ErrorIs(t, err, ErrMatchNotFound)
+	}},
+	{"Update", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		match := testMatch("1")
+		require.NoError(t, b.db.AddMatch(ctx, match))
+		match.Events = []string{"10", "11"}
+		match.LastEvent = "11"
+		match.HomeTeamPenaltyResults = ":large_green_circle:----"
+		require.NoError(t, b.db.UpdateMatch(ctx, match))
+		got, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, match, got)
+	}},
+	{"Delete", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		require.NoError(t, b.db.DeleteMatch(ctx, "1"))
+		_, err := b.db.GetMatch(ctx, "1")
+		assert.ErrorIs(t, err, ErrMatchNotFound)
+		assert.NoError(t, b.db.DeleteMatch(ctx, "1"), "deleting a missing match is not an error")
+	}},
+	{"GetAll", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		matches, err := b.db.GetAllMatches(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("2")))
+		matches, err = b.db.GetAllMatches(ctx)
+		require.NoError(t, err)
+		sort.Slice(matches, func(i, j int) bool { return matches[i].MatchId < matches[j].MatchId })
+		assert.Equal(t, []models.Match{testMatch("1"), testMatch("2")}, matches)
+	}},
+	{"Expiry", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		b.fastForward(23 * time.Hour)
+		_, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+
+		// Updates push the expiry back
+		match := testMatch("1")
+		match.Events = []string{"10"}
+		require.NoError(t, b.db.UpdateMatch(ctx, match))
+		b.fastForward(23 * time.Hour)
+		got, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10"}, got.Events, "claimed events live as long as the match")
+		b.fastForward(time.Hour)
+		_, err = b.db.GetMatch(ctx, "1")
+		assert.ErrorIs(t, err, ErrMatchNotFound)
+		matches, err := b.db.GetAllMatches(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+	}},
+	{"MatchTTL", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		b.db.(interface{ SetMatchTTL(time.Duration) }).SetMatchTTL(2 * time.Hour)
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		b.fastForward(time.Hour)
+		require.NoError(t, b.db.UpdateMatch(ctx, testMatch("1")))
+		b.fastForward(time.Hour + time.Minute)
+		_, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		b.fastForward(time.Hour)
+		_, err = b.db.GetMatch(ctx, "1")
+		assert.ErrorIs(t, err, ErrMatchNotFound)
+	}},
+	{"ClaimEvent", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		_, err := b.db.ClaimEvent(ctx, "1", "10")
+		assert.ErrorIs(t, err, ErrMatchNotFound)
+
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		claimed, err := b.db.ClaimEvent(ctx, "1", "10")
+		require.NoError(t, err)
+		assert.True(t, claimed)
+		claimed, err = b.db.ClaimEvent(ctx, "1", "10")
+		require.NoError(t, err)
+		assert.False(t, claimed, "an event can only be claimed once")
+
+		// A stale copy of the match must not drop claimed events
+		stale := testMatch("1")
+		stale.Events = []string{"11"}
+		require.NoError(t, b.db.UpdateMatch(ctx, stale))
+		got, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"10", "11"}, got.Events)
+		claimed, err = b.db.ClaimEvent(ctx, "1", "11")
+		require.NoError(t, err)
+		assert.False(t, claimed)
+	}},
+	{"ClaimEventConcurrently", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		wins := 0
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := b.db.ClaimEvent(ctx, "1", "10")
+				assert.NoError(t, err)
+				if claimed {
+					mu.Lock()
+					wins++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, wins)
+	}},
+	{"ResetMatch", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		claimed, err := b.db.ClaimEvent(ctx, "1", "10")
+		require.NoError(t, err)
+		require.True(t, claimed)
+		require.NoError(t, b.db.RecordEvent(ctx, "1", models.EventRecord{EventID: "10", Type: 7, Message: "Kick off"}))
+
+		require.NoError(t, b.db.ResetMatch(ctx, "1"))
+		got, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		assert.Empty(t, got.Events)
+		records, err := b.db.GetEventRecords(ctx, "1")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+		claimed, err = b.db.ClaimEvent(ctx, "1", "10")
+		require.NoError(t, err)
+		assert.True(t, claimed, "a reset event can be claimed again")
+		require.NoError(t, b.db.ResetMatch(ctx, "2"), "resetting an unknown match is a no-op")
+	}},
+	{"EventRecords", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		kickoff := time.Date(2026, 6, 11, 19, 0, 0, 0, time.UTC)
+		goal := models.EventRecord{
+			Version:     models.EventRecordVersion,
+			EventID:     "11",
+			Type:        0,
+			Period:      3,
+			Minute:      "23'",
+			TeamID:      "43971",
+			HomeGoals:   1,
+			Timestamp:   kickoff.Add(23 * time.Minute),
+			Description: "Lionel Messi scores",
+			Message:     "23' :soccer: Lionel Messi scores",
+			Payload:     []byte(`{"EventId":"11"}`),
+		}
+		start := models.EventRecord{
+			Version:   models.EventRecordVersion,
+			EventID:   "10",
+			Type:      7,
+			Period:    3,
+			Timestamp: kickoff,
+			Message:   "Kick off",
+		}
+		assert.ErrorIs(t, b.db.RecordEvent(ctx, "1", start), ErrMatchNotFound)
+		records, err := b.db.GetEventRecords(ctx, "1")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		require.NoError(t, b.db.RecordEvent(ctx, "1", goal))
+		require.NoError(t, b.db.RecordEvent(ctx, "1", start))
+		// Recording an event again replaces it
+		goal.Message = "23' :soccer: Lionel Messi scores (corrected)"
+		require.NoError(t, b.db.RecordEvent(ctx, "1", goal))
+		require.NoError(t, b.db.UpdateMatch(ctx, testMatch("1")))
+
+		records, err = b.db.GetEventRecords(ctx, "1")
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, "10", records[0].EventID)
+		assert.True(t, kickoff.Equal(records[0].Timestamp))
+		assert.Equal(t, "11", records[1].EventID)
+		assert.Equal(t, goal.Message, records[1].Message)
+		assert.Equal(t, goal.Description, records[1].Description)
+		assert.Equal(t, goal.TeamID, records[1].TeamID)
+		assert.Equal(t, "23'", records[1].Minute)
+		assert.Equal(t, 1, records[1].HomeGoals)
+		assert.Equal(t, models.EventRecordVersion, records[1].Version)
+
+		if _, keepsHistory := b.db.(History); keepsHistory {
+			return
+		}
+		require.NoError(t, b.db.DeleteMatch(ctx, "1"))
+		records, err = b.db.GetEventRecords(ctx, "1")
+		require.NoError(t, err)
+		assert.Empty(t, records, "records are deleted with the match")
+	}},
+	{"EventRecordsExpireWithMatch", func(t *testing.T, b backend) {
+		if _, keepsHistory := b.db.(History); keepsHistory {
+			t.Skip("backend keeps event history after a match expires")
+		}
+		ctx := context.Background()
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		require.NoError(t, b.db.RecordEvent(ctx, "1", models.EventRecord{EventID: "10", Message: "Kick off"}))
+		b.fastForward(24 * time.Hour)
+		records, err := b.db.GetEventRecords(ctx, "1")
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	}},
+	{"QuarantinesUnknownEvents", func(t *testing.T, b backend) {
+		q, ok := b.db.(Quarantine)
+		require.True(t, ok, "every backend quarantines unknown events")
+		ctx := context.Background()
+		seen := time.Date(2026, 6, 14, 18, 0, 0, 0, time.UTC)
+		first := models.UnknownEvent{MatchID: "1", CompetitionID: "17", EventID: "10", Type: 99, Minute: "12'", Payload: []byte(`{"Id":"10","Type":99}`), SeenAt: seen}
+		second := models.UnknownEvent{MatchID: "2", CompetitionID: "17", EventID: "20", Type: 99, Payload: []byte(`{"Id":"20","Type":99}`), SeenAt: seen.Add(time.Hour)}
+		other := models.UnknownEvent{MatchID: "1", CompetitionID: "17", EventID: "11", Type: 98, Payload: []byte(`{"Id":"11","Type":98}`), SeenAt: seen.Add(time.Minute)}
+		for _, e := range []models.UnknownEvent{second, first, other, first} {
+			require.NoError(t, q.QuarantineEvent(ctx, e))
+		}
+
+		// Quarantined events do not expire with their match
+		b.fastForward(48 * time.Hour)
+		events, err := q.GetUnknownEvents(ctx)
+		require.NoError(t, err)
+		require.Len(t, events, 3, "quarantining an event again replaces it")
+		assert.Equal(t, []string{"10", "11", "20"}, []string{events[0].EventID, events[1].EventID, events[2].EventID})
+		assert.Equal(t, "12'", events[0].Minute)
+		assert.Equal(t, "17", events[0].CompetitionID)
+		assert.True(t, seen.Equal(events[0].SeenAt))
+		assert.JSONEq(t, string(first.Payload), string(events[0].Payload))
+
+		deleted, err := q.DeleteUnknownEvents(ctx, 99)
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+		events, err = q.GetUnknownEvents(ctx)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, 98, events[0].Type)
+	}},
+	{"Controls", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		require.NoError(t, b.db.AddMatch(ctx, testMatch("1")))
+		require.NoError(t, b.db.SetControl(ctx, models.ControlForced, "1", true))
+		require.NoError(t, b.db.SetControl(ctx, models.ControlForced, "1", true))
+		require.NoError(t, b.db.SetControl(ctx, models.ControlUntracked, "2", true))
+		require.NoError(t, b.db.SetControl(ctx, models.ControlPaused, "", true))
+		require.NoError(t, b.db.SetControl(ctx, models.ControlReset, "3", false), "turning off a control that is not on is a no-op")
+
+		// Controls outlive their match
+		require.NoError(t, b.db.DeleteMatch(ctx, "1"))
+		b.fastForward(48 * time.Hour)
+		controls, err := b.db.GetControls(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, models.Controls{
+			models.ControlForced:    {"1": true},
+			models.ControlUntracked: {"2": true},
+			models.ControlPaused:    {"": true},
+		}, controls)
+
+		require.NoError(t, b.db.SetControl(ctx, models.ControlForced, "1", false))
+		require.NoError(t, b.db.SetControl(ctx, models.ControlPaused, "", false))
+		controls, err = b.db.GetControls(ctx)
+		require.NoError(t, err)
+		assert.False(t, controls.Has(models.ControlForced, "1"))
+		assert.False(t, controls.Has(models.ControlPaused, ""))
+		assert.True(t, controls.Has(models.ControlUntracked, "2"))
+	}},
+	{"ReturnsCopies", func(t *testing.T, b backend) {
+		ctx := context.Background()
+		match := testMatch("1")
+		match.Events = []string{"10"}
+		require.NoError(t, b.db.AddMatch(ctx, match))
+		match.Events[0] = "changed"
+		got, err := b.db.GetMatch(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10"}, got.Events)
+	}},
+}
+
+func TestBoltPersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fifa-bot.db")
+	db, err := NewBoltClient(path)
+	require.NoError(t, err)
+	match := testMatch("1")
+	require.NoError(t, db.AddMatch(ctx, match))
+	match.Events = []string{"10", "11"}
+	require.NoError(t, db.UpdateMatch(ctx, match))
+	require.NoError(t, db.Close())
+
+	db, err = NewBoltClient(path)
+	require.NoError(t, err)
+	defer db.Close()
+	matches, err := db.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Match{match}, matches)
+}
+
+func TestPostgresKeepsHistory(t *testing.T) {
+	ctx := context.Background()
+	db := newPostgresTestClient(t)
+	match := testMatch("1")
+	require.NoError(t, db.AddMatch(ctx, match))
+	require.NoError(t, db.RecordEvent(ctx, "1", models.EventRecord{
+		EventID:     "10",
+		Minute:      "12'",
+		HomeGoals:   1,
+		Description: "Player one scores!",
+		Message:     "12' :soccer: Player one scores! 1 ARG :flag-ar: : :flag-eg: EGY 0",
+		Payload:     []byte(`{"EventId":"10"}`),
+	}))
+	require.NoError(t, db.RecordNotification(ctx, "1", "10", "slack", errors.New("500 Internal Server Error")))
+	require.NoError(t, db.RecordNotification(ctx, "1", "10", "slack", nil))
+	match.Events = []string{"10", "11"}
+	require.NoError(t, db.UpdateMatch(ctx, match))
+
+	got, err := db.GetMatch(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10", "11"}, got.Events)
+
+	require.NoError(t, db.DeleteMatch(ctx, "1"))
+	_, err = db.GetMatch(ctx, "1")
+	assert.ErrorIs(t, err, ErrMatchNotFound)
+
+	var message string
+	var delivered, failed int
+	err = db.pool.QueryRow(ctx, "SELECT message FROM match_events WHERE match_id = '1' AND event_id = '10'").Scan(&message)
+	require.NoError(t, err)
+	assert.Equal(t, "12' :soccer: Player one scores! 1 ARG :flag-ar: : :flag-eg: EGY 0", message)
+	err = db.pool.QueryRow(ctx, "SELECT count(*) FILTER (WHERE delivered), count(*) FILTER (WHERE NOT delivered) FROM notifications").Scan(&delivered, &failed)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, 1, failed)
+}
+
+func TestRedisIndexesLegacyMatches(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := NewRedisClient(mr.Addr(), "", 0, "")
+	defer db.client.Close()
+
+	legacy := testMatch("5")
+	data, err := legacy.GetMap()
+	require.NoError(t, err)
+	require.NoError(t, db.client.HSet(ctx, "match:5", data).Err())
+
+	matches, err := db.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Match{testMatch("5")}, matches)
+	members, err := db.client.SMembers(ctx, db.indexKey()).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5"}, members)
+
+	// The keyspace is scanned once, not every time the index is empty
+	require.NoError(t, db.DeleteMatch(ctx, "5"))
+	require.NoError(t, db.client.HSet(ctx, "match:6", data).Err())
+	matches, err = db.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestRedisClaimSeesLegacyEvents(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := NewRedisClient(mr.Addr(), "", 0, "")
+	defer db.client.Close()
+
+	// Written before processed events had their own set
+	legacy := testMatch("5")
+	legacy.Events = []string{"10", "11"}
+	data, err := legacy.GetMap()
+	require.NoError(t, err)
+	require.NoError(t, db.client.HSet(ctx, "match:5", data).Err())
+
+	claimed, err := db.ClaimEvent(ctx, "5", "10")
+	require.NoError(t, err)
+	assert.False(t, claimed, "events processed before the upgrade are not announced again")
+	claimed, err = db.ClaimEvent(ctx, "5", "12")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	members, err := db.client.SMembers(ctx, "match:5:events").Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"10", "11", "12"}, members)
+}
+
+func TestRedisPrunesExpiredMatchesFromIndex(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := NewRedisClient(mr.Addr(), "", 0, "")
+	defer db.client.Close()
+
+	require.NoError(t, db.AddMatch(ctx, testMatch("1")))
+	require.NoError(t, db.AddMatch(ctx, testMatch("2")))
+	require.NoError(t, db.client.Persist(ctx, "match:2").Err())
+	mr.FastForward(25 * time.Hour)
+
+	matches, err := db.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Match{testMatch("2")}, matches)
+	members, err := db.client.SMembers(ctx, db.indexKey()).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, members)
+}
+
+func TestRedisNamespacesAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	prod := NewRedisClient(mr.Addr(), "", 0, "prod")
+	defer prod.client.Close()
+	staging := NewRedisClient(mr.Addr(), "", 0, "staging")
+	defer staging.client.Close()
+
+	require.NoError(t, prod.AddMatch(ctx, testMatch("1")))
+	assert.True(t, mr.Exists("prod:match:1"))
+	assert.True(t, mr.Exists("prod:matches"))
+
+	_, err := staging.GetMatch(ctx, "1")
+	assert.ErrorIs(t, err, ErrMatchNotFound)
+	matches, err := staging.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	require.NoError(t, staging.DeleteMatch(ctx, "1"))
+	_, err = prod.GetMatch(ctx, "1")
+	assert.NoError(t, err)
+}
+
+func TestRedisMigrateUnprefixedKeys(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	legacy := NewRedisClient(mr.Addr(), "", 0, "")
+	defer legacy.client.Close()
+	require.NoError(t, legacy.AddMatch(ctx, testMatch("1")))
+	require.NoError(t, legacy.AddMatch(ctx, testMatch("2")))
+	for _, id := range []string{"1", "2"} {
+		_, err := legacy.ClaimEvent(ctx, id, "10")
+		require.NoError(t, err)
+		require.NoError(t, legacy.RecordEvent(ctx, id, models.EventRecord{EventID: "10", Type: 7, Message: "Kick off"}))
+	}
+	require.NoError(t, legacy.SetControl(ctx, models.ControlPaused, "", true))
+	require.NoError(t, legacy.SetControl(ctx, models.ControlForced, "1", true))
+	seen := time.Date(2026, 6, 14, 18, 0, 0, 0, time.UTC)
+	require.NoError(t, legacy.QuarantineEvent(ctx, models.UnknownEvent{MatchID: "1", EventID: "11", Type: 99, SeenAt: seen}))
+	require.NoError(t, legacy.QuarantineEvent(ctx, models.UnknownEvent{MatchID: "1", EventID: "12", Type: 99, Minute: "legacy", SeenAt: seen}))
+	// Sets the unprefixed index marker
+	_, err := legacy.GetAllMatches(ctx)
+	require.NoError(t, err)
+
+	prod := NewRedisClient(mr.Addr(), "", 0, "prod")
+	defer prod.client.Close()
+	// Match 2 already exists in the namespace and must not be overwritten
+	existing := testMatch("2")
+	existing.LastEvent = "99"
+	require.NoError(t, prod.AddMatch(ctx, existing))
+	require.NoError(t, prod.SetControl(ctx, models.ControlUntracked, "3", true))
+	require.NoError(t, prod.QuarantineEvent(ctx, models.UnknownEvent{MatchID: "1", EventID: "12", Type: 99, Minute: "prod", SeenAt: seen}))
+	// The namespace was already indexed, without match 1
+	_, err = prod.GetAllMatches(ctx)
+	require.NoError(t, err)
+
+	moved, err := prod.MigrateUnprefixedKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, moved)
+	assert.Positive(t, mr.TTL("prod:match:1"), "the expiry is kept")
+	for _, key := range mr.Keys() {
+		if !strings.HasPrefix(key, "prod:") {
+			assert.True(t, strings.HasPrefix(key, "match:2"), "%s was not moved", key)
+		}
+	}
+
+	matches, err := prod.GetAllMatches(ctx)
+	require.NoError(t, err)
+	sort.Slice(matches, func(i, j int) bool { return matches[i].MatchId < matches[j].MatchId })
+	moved1 := testMatch("1")
+	moved1.Events = []string{"10"}
+	assert.Equal(t, []models.Match{moved1, existing}, matches)
+	claimed, err := prod.ClaimEvent(ctx, "1", "10")
+	require.NoError(t, err)
+	assert.False(t, claimed, "claims move with their match")
+	records, err := prod.GetEventRecords(ctx, "1")
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+	records, err = prod.GetEventRecords(ctx, "2")
+	require.NoError(t, err)
+	assert.Empty(t, records, "a match left alone keeps its own records")
+
+	controls, err := prod.GetControls(ctx)
+	require.NoError(t, err)
+	assert.True(t, controls.Has(models.ControlPaused, ""))
+	assert.True(t, controls.Has(models.ControlForced, "1"))
+	assert.True(t, controls.Has(models.ControlUntracked, "3"))
+	unknown, err := prod.GetUnknownEvents(ctx)
+	require.NoError(t, err)
+	require.Len(t, unknown, 2)
+	assert.Equal(t, "11", unknown[0].EventID)
+	assert.Equal(t, "prod", unknown[1].Minute, "the namespace's copy is kept")
+
+	moved, err = prod.MigrateUnprefixedKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, moved, "running the migration again is a no-op")
+}
+
+func TestRedisRejectsNewerEventRecords(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := NewRedisClient(mr.Addr(), "", 0, "")
+	defer db.client.Close()
+	require.NoError(t, db.AddMatch(ctx, testMatch("1")))
+	mr.HSet("match:1:records", "10", `{"v":99,"id":"10","type":7}`)
+	_, err := db.GetEventRecords(ctx, "1")
+	assert.ErrorContains(t, err, "unsupported event record version 99")
+}
+
+func TestRedisUpgradesUnversionedMatches(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := NewRedisClient(mr.Addr(), "", 0, "")
+	defer db.client.Close()
+
+	// Written before matches carried a schema version
+	mr.HSet("match:5",
+		"competition_id", "17",
+		"season_id", "285023",
+		"stage_id", "289287",
+		"match_id", "5",
+		"home_team_abbrev", "ARG",
+		"events", "",
+	)
+	match, err := db.GetMatch(ctx, "5")
+	require.NoError(t, err)
+	assert.Equal(t, "ARG", match.HomeTeamAbbrev)
+	assert.Empty(t, match.Events)
+
+	// Saving writes the current version
+	require.NoError(t, db.UpdateMatch(ctx, match))
+	assert.Equal(t, strconv.Itoa(models.MatchSchemaVersion), mr.HGet("match:5", "schema_version"))
+}
+
+func TestRedisReportsUndecodableMatches(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	db := NewRedisClient(mr.Addr(), "", 0, "")
+	defer db.client.Close()
+
+	require.NoError(t, db.AddMatch(ctx, testMatch("1")))
+	mr.HSet("match:2", "match_id", "2", "competition_id", "17")
+	mr.HSet("match:3", "match_id", "3", "competition_id", "17", "season_id", "1", "stage_id", "2", "schema_version", "99")
+	mr.SAdd("matches", "2", "3")
+
+	_, err := db.GetMatch(ctx, "2")
+	assert.ErrorContains(t, err, "missing season_id, stage_id")
+	invalid, err := db.ValidateMatches(ctx)
+	require.NoError(t, err)
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].MatchID < invalid[j].MatchID })
+	require.Len(t, invalid, 2)
+	assert.Equal(t, "2", invalid[0].MatchID)
+	assert.ErrorContains(t, invalid[0].Err, "match record is missing season_id, stage_id")
+	assert.Equal(t, "3", invalid[1].MatchID)
+	assert.ErrorContains(t, invalid[1].Err, "schema version 99")
+
+	matches, err := db.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Match{testMatch("1")}, matches, "undecodable matches are skipped")
+}
+
+func TestBoltReportsUndecodableMatches(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewBoltClient(filepath.Join(t.TempDir(), "fifa-bot.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.AddMatch(ctx, testMatch("1")))
+	require.NoError(t, db.db.Update(func(tx *bolt.Tx) error {
+		if err := putRecord(tx, "2", boltRecord{Fields: map[string]string{"match_id": "2"}}); err != nil {
+			return err
+		}
+		return tx.Bucket(boltMatchesBucket).Put([]byte("3"), []byte("not json"))
+	}))
+
+	invalid, err := db.ValidateMatches(ctx)
+	require.NoError(t, err)
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].MatchID < invalid[j].MatchID })
+	require.Len(t, invalid, 2)
+	assert.Equal(t, "2", invalid[0].MatchID)
+	assert.Equal(t, "3", invalid[1].MatchID)
+
+	matches, err := db.GetAllMatches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Match{testMatch("1")}, matches)
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/models"
+)
+
+type memoryEntry struct {
+	match     models.Match
+	records   []models.EventRecord
+	expiresAt time.Time
+}
+
+type memoryClient struct {
+	mu       sync.Mutex
+	matches  map[string]memoryEntry
+	unknown  []models.UnknownEvent
+	controls models.Controls
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+var _ Database = (*memoryClient)(nil)
+var _ Quarantine = (*memoryClient)(nil)
+
+// NewMemoryClient returns a Database that keeps matches in process memory.
+// State is lost on restart, so it is meant for tests and local development.
+func NewMemoryClient() *memoryClient {
+	return &memoryClient{
+		matches:  map[string]memoryEntry{},
+		controls: models.Controls{},
+		ttl:      DefaultMatchTTL,
+		now:      time.Now,
+	}
+}
+
+// SetMatchTTL sets how long a match is kept after it was last added or
+// updated.
+func (m *memoryClient) SetMatchTTL(ttl time.Duration) {
+	m.ttl = ttl
+}
+
+func (m *memoryClient) AddMatch(ctx context.Context, match models.Match) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matches[match.MatchId] = memoryEntry{
+		match:     copyMatch(match),
+		expiresAt: m.now().Add(m.ttl),
+	}
+	return nil
+}
+
+func (m *memoryClient) GetMatch(ctx context.Context, matchID string) (models.Match, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, exists := m.get(matchID)
+	if !exists {
+		return models.Match{}, ErrMatchNotFound
+	}
+	return copyMatch(entry.match), nil
+}
+
+func (m *memoryClient) DeleteMatch(ctx context.Context, matchID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.matches, matchID)
+	return nil
+}
+
+// UpdateMatch pushes the expiry back, since the match is still active. Events
+// already claimed are kept even if they are missing from match.
+func (m *memoryClient) UpdateMatch(ctx context.Context, match models.Match) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, _ := m.get(match.MatchId)
+	claimed := entry.match.Events
+	entry.match = copyMatch(match)
+	entry.match.Events = mergeEvents(entry.match.Events, claimed)
+	entry.expiresAt = m.now().Add(m.ttl)
+	m.matches[match.MatchId] = entry
+	return nil
+}
+
+func (m *memoryClient) ClaimEvent(ctx context.Context, matchID string, eventID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, exists := m.get(matchID)
+	if !exists {
+		return false, ErrMatchNotFound
+	}
+	if slices.Contains(entry.match.Events, eventID) {
+		return false, nil
+	}
+	entry.match.Events = append(entry.match.Events, eventID)
+	m.matches[matchID] = entry
+	return true, nil
+}
+
+func (m *memoryClient) ResetMatch(ctx context.Context, matchID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, exists := m.get(matchID)
+	if !exists {
+		return nil
+	}
+	entry.match.Events = nil
+	entry.records = nil
+	m.matches[matchID] = entry
+	return nil
+}
+
+func (m *memoryClient) GetAllMatches(ctx context.Context) ([]models.Match, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	matches := []models.Match{}
+	for id := range m.matches {
+		entry, exists := m.get(id)
+		if !exists {
+			continue
+		}
+		matches = append(matches, copyMatch(entry.match))
+	}
+	return matches, nil
+}
+
+func (m *memoryClient) RecordEvent(ctx context.Context, matchID string, event models.EventRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, exists := m.get(matchID)
+	if !exists {
+		return ErrMatchNotFound
+	}
+	event.Payload = nil
+	entry.records = putEventRecord(slices.Clone(entry.records), event)
+	m.matches[matchID] = entry
+	return nil
+}
+
+func (m *memoryClient) GetEventRecords(ctx context.Context, matchID string) ([]models.EventRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, _ := m.get(matchID)
+	return sortEventRecords(slices.Clone(entry.records)), nil
+}
+
+func (m *memoryClient) QuarantineEvent(ctx context.Context, event models.UnknownEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.Payload = slices.Clone(event.Payload)
+	m.unknown = putUnknownEvent(m.unknown, event)
+	return nil
+}
+
+func (m *memoryClient) GetUnknownEvents(ctx context.Context) ([]models.UnknownEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := make([]models.UnknownEvent, len(m.unknown))
+	for i, e := range m.unknown {
+		e.Payload = slices.Clone(e.Payload)
+		events[i] = e
+	}
+	return sortUnknownEvents(events), nil
+}
+
+func (m *memoryClient) DeleteUnknownEvents(ctx context.Context, eventType int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.unknown)
+	m.unknown = slices.DeleteFunc(m.unknown, func(e models.UnknownEvent) bool { return e.Type == eventType })
+	return before - len(m.unknown), nil
+}
+
+func (m *memoryClient) SetControl(ctx context.Context, control models.Control, matchID string, on bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.controls.Set(control, matchID, on)
+	return nil
+}
+
+func (m *memoryClient) GetControls(ctx context.Context) (models.Controls, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.controls.Clone(), nil
+}
+
+// get returns the entry for matchID, dropping it if it has expired. The caller
+// must hold m.mu.
+func (m *memoryClient) get(matchID string) (memoryEntry, bool) {
+	entry, exists := m.matches[matchID]
+	if !exists {
+		return memoryEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && !m.now().Before(entry.expiresAt) {
+		delete(m.matches, matchID)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func copyMatch(match models.Match) models.Match {
+	match.Events = slices.Clone(match.Events)
+	return match
+}
+
+// putEventRecord replaces the record with the same event ID, or appends it.
+func putEventRecord(records []models.EventRecord, event models.EventRecord) []models.EventRecord {
+	if event.Version == 0 {
+		event.Version = models.EventRecordVersion
+	}
+	i := slices.IndexFunc(records, func(r models.EventRecord) bool { return r.EventID == event.EventID })
+	if i >= 0 {
+		records[i] = event
+		return records
+	}
+	return append(records, event)
+}
+
+// sortEventRecords orders records by when the event happened. Events without a
+// timestamp keep their relative order.
+func sortEventRecords(records []models.EventRecord) []models.EventRecord {
+	if records == nil {
+		records = []models.EventRecord{}
+	}
+	slices.SortStableFunc(records, func(a, b models.EventRecord) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return records
+}
+
+// mergeEvents appends the IDs in extra that are not already in events.
+func mergeEvents(events []string, extra []string) []string {
+	for _, id := range extra {
+		if !slices.Contains(events, id) {
+			events = append(events, id)
+		}
+	}
+	return events
+}
+
+// putUnknownEvent replaces the event with the same match and event ID, or
+// appends it.
+func putUnknownEvent(events []models.UnknownEvent, event models.UnknownEvent) []models.UnknownEvent {
+	i := slices.IndexFunc(events, func(e models.UnknownEvent) bool {
+		return e.MatchID == event.MatchID && e.EventID == event.EventID
+	})
+	if i >= 0 {
+		events[i] = event
+		return events
+	}
+	return append(events, event)
+}
+
+// sortUnknownEvents orders events by when they were seen.
+func sortUnknownEvents(events []models.UnknownEvent) []models.UnknownEvent {
+	if events == nil {
+		events = []models.UnknownEvent{}
+	}
+	slices.SortStableFunc(events, func(a, b models.UnknownEvent) int {
+		return a.SeenAt.Compare(b.SeenAt)
+	})
+	return events
+}
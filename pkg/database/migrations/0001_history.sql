@@ -0,0 +1,54 @@
+CREATE TABLE matches (
+    match_id                  TEXT PRIMARY KEY,
+    competition_id            TEXT NOT NULL,
+    season_id                 TEXT NOT NULL,
+    stage_id                  TEXT NOT NULL,
+    home_team_id              TEXT NOT NULL DEFAULT '',
+    away_team_id              TEXT NOT NULL DEFAULT '',
+    home_team_name            TEXT NOT NULL DEFAULT '',
+    away_team_name            TEXT NOT NULL DEFAULT '',
+    home_team_abbrev          TEXT NOT NULL DEFAULT '',
+    away_team_abbrev          TEXT NOT NULL DEFAULT '',
+    home_team_penalty_results TEXT NOT NULL DEFAULT '',
+    away_team_penalty_results TEXT NOT NULL DEFAULT '',
+    last_event                TEXT NOT NULL DEFAULT '',
+    active                    BOOLEAN NOT NULL DEFAULT TRUE,
+    expires_at                TIMESTAMPTZ,
+    created_at                TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at                TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at               TIMESTAMPTZ
+);
+
+CREATE INDEX matches_competition_idx ON matches (competition_id, season_id);
+
+CREATE TABLE match_events (
+    id          BIGSERIAL PRIMARY KEY,
+    match_id    TEXT NOT NULL REFERENCES matches (match_id) ON DELETE CASCADE,
+    event_id    TEXT NOT NULL,
+    event_type  INTEGER,
+    period      INTEGER,
+    minute      TEXT NOT NULL DEFAULT '',
+    team_id     TEXT NOT NULL DEFAULT '',
+    home_goals  INTEGER,
+    away_goals  INTEGER,
+    occurred_at TIMESTAMPTZ,
+    description TEXT NOT NULL DEFAULT '',
+    message     TEXT NOT NULL DEFAULT '',
+    unknown     BOOLEAN NOT NULL DEFAULT FALSE,
+    payload     JSONB,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (match_id, event_id)
+);
+
+CREATE INDEX match_events_type_idx ON match_events (event_type);
+
+CREATE TABLE notifications (
+    id           BIGSERIAL PRIMARY KEY,
+    match_id     TEXT NOT NULL,
+    event_id     TEXT NOT NULL,
+    destination  TEXT NOT NULL,
+    delivered    BOOLEAN NOT NULL,
+    error        TEXT NOT NULL DEFAULT '',
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    FOREIGN KEY (match_id, event_id) REFERENCES match_events (match_id, event_id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+CREATE TABLE unknown_events (
+    match_id       TEXT NOT NULL,
+    event_id       TEXT NOT NULL,
+    competition_id TEXT NOT NULL DEFAULT '',
+    event_type     INTEGER NOT NULL,
+    minute         TEXT NOT NULL DEFAULT '',
+    payload        JSONB NOT NULL,
+    seen_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (match_id, event_id)
+);
+
+CREATE INDEX unknown_events_type_idx ON unknown_events (event_type);
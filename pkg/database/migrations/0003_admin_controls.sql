@@ -0,0 +1,6 @@
+CREATE TABLE admin_controls (
+    control    TEXT NOT NULL,
+    match_id   TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (control, match_id)
+);
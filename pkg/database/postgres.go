@@ -0,0 +1,512 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock held while migrations run, so that
+// several instances starting at once apply each migration only once.
+const migrationLockID = 7_146_201_926
+
+type postgresClient struct {
+	pool *pgxpool.Pool
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+var _ Database = (*postgresClient)(nil)
+var _ History = (*postgresClient)(nil)
+var _ Pinger = (*postgresClient)(nil)
+var _ Quarantine = (*postgresClient)(nil)
+
+// NewPostgresClient connects to Postgres and applies any pending schema
+// migrations. Unlike the other backends, finished matches and their events are
+// kept rather than deleted.
+func NewPostgresClient(ctx context.Context, url string) (*postgresClient, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres. %w", err)
+	}
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to migrate postgres schema. %w", err)
+	}
+	return &postgresClient{
+		pool: pool,
+		ttl:  DefaultMatchTTL,
+		now:  time.Now,
+	}, nil
+}
+
+func (p *postgresClient) Close() {
+	p.pool.Close()
+}
+
+// SetMatchTTL sets how long a match stays active after it was last added or
+// updated.
+func (p *postgresClient) SetMatchTTL(ttl time.Duration) {
+	p.ttl = ttl
+}
+
+func (p *postgresClient) Ping(ctx context.Context) error {
+	if err := p.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping postgres. %w", err)
+	}
+	return nil
+}
+
+func (p *postgresClient) AddMatch(ctx context.Context, match models.Match) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction. %w", err)
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `
+		INSERT INTO matches (
+			match_id, competition_id, season_id, stage_id,
+			home_team_id, away_team_id, home_team_name, away_team_name,
+			home_team_abbrev, away_team_abbrev, home_team_penalty_results,
+			away_team_penalty_results, last_event, active, expires_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, TRUE, $14, $15)
+		ON CONFLICT (match_id) DO UPDATE SET
+			competition_id = EXCLUDED.competition_id,
+			season_id = EXCLUDED.season_id,
+			stage_id = EXCLUDED.stage_id,
+			home_team_id = EXCLUDED.home_team_id,
+			away_team_id = EXCLUDED.away_team_id,
+			home_team_name = EXCLUDED.home_team_name,
+			away_team_name = EXCLUDED.away_team_name,
+			home_team_abbrev = EXCLUDED.home_team_abbrev,
+			away_team_abbrev = EXCLUDED.away_team_abbrev,
+			home_team_penalty_results = EXCLUDED.home_team_penalty_results,
+			away_team_penalty_results = EXCLUDED.away_team_penalty_results,
+			last_event = EXCLUDED.last_event,
+			active = TRUE,
+			expires_at = EXCLUDED.expires_at,
+			updated_at = EXCLUDED.updated_at,
+			finished_at = NULL`,
+		match.MatchId, match.CompetitionId, match.SeasonId, match.StageId,
+		match.HomeTeamID, match.AwayTeamID, match.HomeTeamName, match.AwayTeamName,
+		match.HomeTeamAbbrev, match.AwayTeamAbbrev, match.HomeTeamPenaltyResults,
+		match.AwayTeamPenaltyResults, match.LastEvent, p.now().Add(p.ttl), p.now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save match to postgres. %w", err)
+	}
+	if err := insertEventIDs(ctx, tx, match); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit match. %w", err)
+	}
+	return nil
+}
+
+func (p *postgresClient) GetMatch(ctx context.Context, matchID string) (models.Match, error) {
+	matches, err := p.queryMatches(ctx, "match_id = $2", matchID)
+	if err != nil {
+		return models.Match{}, fmt.Errorf("failed to get match %s from database. %w", matchID, err)
+	}
+	if len(matches) == 0 {
+		return models.Match{}, ErrMatchNotFound
+	}
+	return matches[0], nil
+}
+
+// DeleteMatch retires the match so it is no longer returned, but keeps the
+// match and its events for history.
+func (p *postgresClient) DeleteMatch(ctx context.Context, matchID string) error {
+	_, err := p.pool.Exec(ctx, `
+		UPDATE matches SET active = FALSE, finished_at = $2, updated_at = $2
+		WHERE match_id = $1 AND active`,
+		matchID, p.now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark match finished in postgres. %w", err)
+	}
+	return nil
+}
+
+// UpdateMatch pushes the expiry back, matching the Redis backend.
+func (p *postgresClient) UpdateMatch(ctx context.Context, match models.Match) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction. %w", err)
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `
+		INSERT INTO matches (
+			match_id, competition_id, season_id, stage_id,
+			home_team_id, away_team_id, home_team_name, away_team_name,
+			home_team_abbrev, away_team_abbrev, home_team_penalty_results,
+			away_team_penalty_results, last_event, active, expires_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, TRUE, $14, $15)
+		ON CONFLICT (match_id) DO UPDATE SET
+			home_team_penalty_results = EXCLUDED.home_team_penalty_results,
+			away_team_penalty_results = EXCLUDED.away_team_penalty_results,
+			last_event = EXCLUDED.last_event,
+			expires_at = EXCLUDED.expires_at,
+			updated_at = EXCLUDED.updated_at`,
+		match.MatchId, match.CompetitionId, match.SeasonId, match.StageId,
+		match.HomeTeamID, match.AwayTeamID, match.HomeTeamName, match.AwayTeamName,
+		match.HomeTeamAbbrev, match.AwayTeamAbbrev, match.HomeTeamPenaltyResults,
+		match.AwayTeamPenaltyResults, match.LastEvent, p.now().Add(p.ttl), p.now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update match in postgres. %w", err)
+	}
+	if err := insertEventIDs(ctx, tx, match); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit match. %w", err)
+	}
+	return nil
+}
+
+func (p *postgresClient) GetAllMatches(ctx context.Context) ([]models.Match, error) {
+	matches, err := p.queryMatches(ctx, "TRUE")
+	if err != nil {
+		return []models.Match{}, fmt.Errorf("failed to get matches from postgres. %w", err)
+	}
+	return matches, nil
+}
+
+// ClaimEvent inserts the event's row, relying on the unique (match_id,
+// event_id) constraint so only one caller gets to claim it.
+func (p *postgresClient) ClaimEvent(ctx context.Context, matchID string, eventID string) (bool, error) {
+	var active bool
+	err := p.pool.QueryRow(ctx, `
+		SELECT active AND (expires_at IS NULL OR expires_at > $2) FROM matches WHERE match_id = $1`,
+		matchID, p.now(),
+	).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !active) {
+		return false, ErrMatchNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get match %s from database. %w", matchID, err)
+	}
+	tag, err := p.pool.Exec(ctx, `
+		INSERT INTO match_events (match_id, event_id) VALUES ($1, $2)
+		ON CONFLICT (match_id, event_id) DO NOTHING`,
+		matchID, eventID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event %s for match %s. %w", eventID, matchID, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ResetMatch deletes the match's event rows, which also drops the history of
+// notifications sent for them.
+func (p *postgresClient) ResetMatch(ctx context.Context, matchID string) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM match_events WHERE match_id = $1`, matchID)
+	if err != nil {
+		return fmt.Errorf("failed to reset match %s in postgres. %w", matchID, err)
+	}
+	return nil
+}
+
+// RecordEvent stores an event seen for a match. Recording the same event again
+// updates the stored copy, which lets corrections from FIFA overwrite it.
+func (p *postgresClient) RecordEvent(ctx context.Context, matchID string, event models.EventRecord) error {
+	var payload any
+	if len(event.Payload) > 0 {
+		payload = string(event.Payload)
+	}
+	var occurredAt *time.Time
+	if !event.Timestamp.IsZero() {
+		occurredAt = &event.Timestamp
+	}
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO match_events (
+			match_id, event_id, event_type, period, minute, team_id, home_goals,
+			away_goals, occurred_at, description, message, unknown, payload
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (match_id, event_id) DO UPDATE SET
+			event_type = EXCLUDED.event_type,
+			period = EXCLUDED.period,
+			minute = EXCLUDED.minute,
+			team_id = EXCLUDED.team_id,
+			home_goals = EXCLUDED.home_goals,
+			away_goals = EXCLUDED.away_goals,
+			occurred_at = EXCLUDED.occurred_at,
+			description = EXCLUDED.description,
+			message = EXCLUDED.message,
+			unknown = EXCLUDED.unknown,
+			payload = EXCLUDED.payload`,
+		matchID, event.EventID, event.Type, event.Period, event.Minute, event.TeamID,
+		event.HomeGoals, event.AwayGoals, occurredAt, event.Description, event.Message,
+		event.Unknown, payload,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record event %s for match %s. %w", event.EventID, matchID, err)
+	}
+	return nil
+}
+
+// GetEventRecords returns the recorded events of a match, including finished
+// ones. Event IDs saved without a record are left out.
+func (p *postgresClient) GetEventRecords(ctx context.Context, matchID string) ([]models.EventRecord, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT event_id, event_type, COALESCE(period, 0), minute, team_id,
+			COALESCE(home_goals, 0), COALESCE(away_goals, 0), occurred_at,
+			description, message, unknown
+		FROM match_events
+		WHERE match_id = $1 AND event_type IS NOT NULL
+		ORDER BY occurred_at NULLS FIRST, id`,
+		matchID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event records for match %s. %w", matchID, err)
+	}
+	defer rows.Close()
+	events := []models.EventRecord{}
+	for rows.Next() {
+		e := models.EventRecord{Version: models.EventRecordVersion}
+		var occurredAt *time.Time
+		err := rows.Scan(&e.EventID, &e.Type, &e.Period, &e.Minute, &e.TeamID,
+			&e.HomeGoals, &e.AwayGoals, &occurredAt, &e.Description, &e.Message, &e.Unknown)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event record for match %s. %w", matchID, err)
+		}
+		if occurredAt != nil {
+			e.Timestamp = *occurredAt
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get event records for match %s. %w", matchID, err)
+	}
+	return events, nil
+}
+
+// RecordNotification stores the outcome of one attempt to deliver an event's
+// message. A nil sendErr means it was delivered.
+func (p *postgresClient) RecordNotification(ctx context.Context, matchID string, eventID string, destination string, sendErr error) error {
+	errText := ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+	}
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO notifications (match_id, event_id, destination, delivered, error, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		matchID, eventID, destination, sendErr == nil, errText, p.now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record notification for event %s. %w", eventID, err)
+	}
+	return nil
+}
+
+// QuarantineEvent stores an unknown event in its own table, so it outlives the
+// match and its event records.
+func (p *postgresClient) QuarantineEvent(ctx context.Context, event models.UnknownEvent) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO unknown_events (match_id, event_id, competition_id, event_type, minute, payload, seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (match_id, event_id) DO UPDATE SET
+			competition_id = EXCLUDED.competition_id,
+			event_type = EXCLUDED.event_type,
+			minute = EXCLUDED.minute,
+			payload = EXCLUDED.payload,
+			seen_at = EXCLUDED.seen_at`,
+		event.MatchID, event.EventID, event.CompetitionID, event.Type, event.Minute,
+		string(event.Payload), event.SeenAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine event %s for match %s. %w", event.EventID, event.MatchID, err)
+	}
+	return nil
+}
+
+func (p *postgresClient) GetUnknownEvents(ctx context.Context) ([]models.UnknownEvent, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT match_id, event_id, competition_id, event_type, minute, payload::text, seen_at
+		FROM unknown_events
+		ORDER BY seen_at, match_id, event_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unknown events. %w", err)
+	}
+	defer rows.Close()
+	events := []models.UnknownEvent{}
+	for rows.Next() {
+		var e models.UnknownEvent
+		var payload string
+		if err := rows.Scan(&e.MatchID, &e.EventID, &e.CompetitionID, &e.Type, &e.Minute, &payload, &e.SeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan unknown event. %w", err)
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get unknown events. %w", err)
+	}
+	return events, nil
+}
+
+func (p *postgresClient) DeleteUnknownEvents(ctx context.Context, eventType int) (int, error) {
+	tag, err := p.pool.Exec(ctx, "DELETE FROM unknown_events WHERE event_type = $1", eventType)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unknown events of type %d. %w", eventType, err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (p *postgresClient) SetControl(ctx context.Context, control models.Control, matchID string, on bool) error {
+	query := "INSERT INTO admin_controls (control, match_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	if !on {
+		query = "DELETE FROM admin_controls WHERE control = $1 AND match_id = $2"
+	}
+	if _, err := p.pool.Exec(ctx, query, string(control), matchID); err != nil {
+		return fmt.Errorf("failed to set %s control for match %q. %w", control, matchID, err)
+	}
+	return nil
+}
+
+func (p *postgresClient) GetControls(ctx context.Context) (models.Controls, error) {
+	rows, err := p.pool.Query(ctx, "SELECT control, match_id FROM admin_controls")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get controls. %w", err)
+	}
+	defer rows.Close()
+	controls := models.Controls{}
+	for rows.Next() {
+		var control, matchID string
+		if err := rows.Scan(&control, &matchID); err != nil {
+			return nil, fmt.Errorf("failed to scan control. %w", err)
+		}
+		controls.Set(models.Control(control), matchID, true)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get controls. %w", err)
+	}
+	return controls, nil
+}
+
+// queryMatches loads active, unexpired matches matching where. The current
+// time is always bound as $1; extra arguments start at $2.
+func (p *postgresClient) queryMatches(ctx context.Context, where string, args ...any) ([]models.Match, error) {
+	args = append([]any{p.now()}, args...)
+	rows, err := p.pool.Query(ctx, `
+		SELECT match_id, competition_id, season_id, stage_id, home_team_id,
+			away_team_id, home_team_name, away_team_name, home_team_abbrev,
+			away_team_abbrev, home_team_penalty_results, away_team_penalty_results,
+			last_event,
+			COALESCE((SELECT array_agg(e.event_id ORDER BY e.id) FROM match_events e WHERE e.match_id = m.match_id), '{}')
+		FROM matches m
+		WHERE active AND (expires_at IS NULL OR expires_at > $1) AND `+where+`
+		ORDER BY match_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	matches := []models.Match{}
+	for rows.Next() {
+		var m models.Match
+		err := rows.Scan(
+			&m.MatchId, &m.CompetitionId, &m.SeasonId, &m.StageId, &m.HomeTeamID,
+			&m.AwayTeamID, &m.HomeTeamName, &m.AwayTeamName, &m.HomeTeamAbbrev,
+			&m.AwayTeamAbbrev, &m.HomeTeamPenaltyResults, &m.AwayTeamPenaltyResults,
+			&m.LastEvent, &m.Events,
+		)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// insertEventIDs makes sure every processed event ID on the match has a row.
+// Events recorded through RecordEvent already have one with full details.
+func insertEventIDs(ctx context.Context, tx pgx.Tx, match models.Match) error {
+	for _, id := range match.Events {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO match_events (match_id, event_id) VALUES ($1, $2)
+			ON CONFLICT (match_id, event_id) DO NOTHING`,
+			match.MatchId, id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save event %s for match %s. %w", id, match.MatchId, err)
+		}
+	}
+	return nil
+}
+
+// migrate applies every embedded migration that has not been applied yet, in
+// order of the numeric prefix of its file name.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table. %w", err)
+	}
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		base := strings.TrimPrefix(name, "migrations/")
+		prefix, _, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("migration %s has no numeric version prefix. %w", base, err)
+		}
+		sql, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := applyMigration(ctx, pool, version, base, string(sql)); err != nil {
+			return fmt.Errorf("failed to apply migration %s. %w", base, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, pool *pgxpool.Pool, version int, name string, sql string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return err
+	}
+	var applied int
+	err = tx.QueryRow(ctx, "SELECT version FROM schema_migrations WHERE version = $1", version).Scan(&applied)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", version, name); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
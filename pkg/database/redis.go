@@ -2,88 +2,368 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/imdevinc/fifa-bot/pkg/models"
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	matchKeyPrefix = "match:"
+	// matchIndexKey is a set holding the ID of every match with a hash.
+	matchIndexKey = "matches"
+	// matchIndexedKey marks that match hashes written before the index
+	// existed were added to it, so the keyspace is only scanned once.
+	matchIndexedKey = "matches:indexed"
+	// eventsKeySuffix is appended to a match key for the set of its processed
+	// event IDs.
+	eventsKeySuffix = ":events"
+	// recordsKeySuffix is appended to a match key for the hash of its encoded
+	// event records, keyed by event ID.
+	recordsKeySuffix = ":records"
+	// unknownEventsKey is a hash of quarantined events, keyed by
+	// "<match ID>/<event ID>".
+	unknownEventsKey = "unknown_events"
+	// controlsKey is a set of the admin controls that are on, as written by
+	// models.Control.Key. It does not expire.
+	controlsKey = "controls"
+)
+
 type redisClient struct {
 	client *redis.Client
+	// prefix is prepended to every key, so several deployments can share one
+	// Redis without seeing each other's matches.
+	prefix string
+	ttl    time.Duration
+	// password is read for every new connection, so it can be rotated
+	password atomic.Pointer[string]
 }
 
 var _ Database = (*redisClient)(nil)
+var _ Validator = (*redisClient)(nil)
+var _ Pinger = (*redisClient)(nil)
+var _ Quarantine = (*redisClient)(nil)
 
-func NewRedisClient(address string, password string, db int) *redisClient {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: password,
-		DB:       db,
+// NewRedisClient returns a Database backed by Redis. When namespace is not
+// empty every key is prefixed with "<namespace>:".
+func NewRedisClient(address string, password string, db int, namespace string) *redisClient {
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + ":"
+	}
+	r := &redisClient{
+		prefix: prefix,
+		ttl:    DefaultMatchTTL,
+	}
+	r.password.Store(&password)
+	r.client = redis.NewClient(&redis.Options{
+		Addr: address,
+		DB:   db,
+		CredentialsProvider: func() (string, string) {
+			return "", *r.password.Load()
+		},
 	})
+	r.client.AddHook(instrumentationHook{})
+	return r
+}
 
-	return &redisClient{
-		client: rdb,
+// SetPassword changes the password used by new connections. Open connections
+// stay authenticated with the old one.
+func (r *redisClient) SetPassword(password string) {
+	r.password.Store(&password)
+}
+
+// SetMatchTTL sets how long a match is kept after it was last added or
+// updated.
+func (r *redisClient) SetMatchTTL(ttl time.Duration) {
+	r.ttl = ttl
+}
+
+func (r *redisClient) Ping(ctx context.Context) error {
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping redis. %w", err)
 	}
+	return nil
 }
 
+// addEventsScript adds event IDs to a match's event set and gives the set the
+// same expiry as the match hash. It returns the number of IDs added.
+var addEventsScript = redis.NewScript(`
+local added = redis.call('SADD', KEYS[1], unpack(ARGV))
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return added
+`)
+
+// claimEventScript atomically marks an event as processed. It returns 1 if
+// the caller claimed the event, 0 if it was already claimed and -1 if the
+// match does not exist. Matches written before events had their own set keep
+// them as JSON in the hash's events field, so the set is seeded from it on
+// the first claim.
+var claimEventScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return -1
+end
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	local legacy = redis.call('HGET', KEYS[2], 'events')
+	if legacy and legacy ~= '' and legacy ~= 'null' then
+		local ok, ids = pcall(cjson.decode, legacy)
+		if ok and type(ids) == 'table' then
+			for _, id in ipairs(ids) do
+				redis.call('SADD', KEYS[1], id)
+			end
+		end
+	end
+end
+local added = redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return added
+`)
+
+// recordEventScript stores an encoded event record and gives the record hash
+// the same expiry as the match hash. It returns -1 if the match does not exist.
+var recordEventScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return -1
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
 func (r *redisClient) AddMatch(ctx context.Context, match models.Match) error {
 	data, err := match.GetMap()
 	if err != nil {
 		return fmt.Errorf("failed to format match. %w", err)
 	}
-	key := getRedisMatchKey(match.MatchId)
+	// Processed events live in their own set, see ClaimEvent
+	delete(data, "events")
+	key := r.matchKey(match.MatchId)
 	_, err = r.client.HSet(ctx, key, data).Result()
 	if err != nil {
 		return fmt.Errorf("failed to save match to redis. %w", err)
 	}
-	resp := r.client.Expire(ctx, key, time.Hour*24)
+	resp := r.client.Expire(ctx, key, r.ttl)
 	if resp.Err() != nil {
-		return fmt.Errorf("failed to mark match for expiration. %w", err)
+		return fmt.Errorf("failed to mark match for expiration. %w", resp.Err())
+	}
+	if err := r.addEvents(ctx, match); err != nil {
+		return err
+	}
+	_, err = r.client.SAdd(ctx, r.indexKey(), match.MatchId).Result()
+	if err != nil {
+		return fmt.Errorf("failed to add match to index. %w", err)
 	}
 	return nil
 }
 
 func (r *redisClient) GetMatch(ctx context.Context, matchID string) (models.Match, error) {
-	key := getRedisMatchKey(matchID)
-	val, err := r.client.HGetAll(ctx, key).Result()
+	var hash *redis.MapStringStringCmd
+	var events *redis.StringSliceCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		hash = pipe.HGetAll(ctx, r.matchKey(matchID))
+		events = pipe.SMembers(ctx, r.eventsKey(matchID))
+		return nil
+	})
 	if err != nil && err != redis.Nil {
 		return models.Match{}, fmt.Errorf("failed to get match %s from database. %w", matchID, err)
 	}
-	if err != nil {
+	if len(hash.Val()) == 0 {
 		return models.Match{}, ErrMatchNotFound
 	}
-	match, err := models.MatchFromRedis(val)
+	match, err := matchFromRedis(hash.Val(), events.Val())
 	if err != nil {
 		return models.Match{}, fmt.Errorf("failed to unmarshal match. %w", err)
 	}
 	return match, nil
 }
 
-func (r *redisClient) GetMatchEvents(ctx context.Context, matchID string) (models.Match, error) {
-	key := getRedisMatchKey(matchID)
-	val, err := r.client.HGetAll(ctx, key).Result()
-	if err != nil && err != redis.Nil {
-		return models.Match{}, fmt.Errorf("failed to get events for match %s. %w", matchID, err)
+// ClaimEvent atomically adds the event to the match's event set, so only one
+// caller, across every instance sharing this Redis, gets true for an event.
+func (r *redisClient) ClaimEvent(ctx context.Context, matchID string, eventID string) (bool, error) {
+	keys := []string{r.eventsKey(matchID), r.matchKey(matchID)}
+	added, err := claimEventScript.Run(ctx, r.client, keys, eventID).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim event %s for match %s. %w", eventID, matchID, err)
+	}
+	if added < 0 {
+		return false, ErrMatchNotFound
+	}
+	return added == 1, nil
+}
+
+// ResetMatch also drops the events field of matches written before events had
+// their own set, otherwise the next claim would seed the set from it again.
+func (r *redisClient) ResetMatch(ctx context.Context, matchID string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, r.eventsKey(matchID), r.recordsKey(matchID))
+		pipe.HDel(ctx, r.matchKey(matchID), "events")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset match %s in redis. %w", matchID, err)
+	}
+	return nil
+}
+
+func (r *redisClient) RecordEvent(ctx context.Context, matchID string, event models.EventRecord) error {
+	data, err := event.Encode()
+	if err != nil {
+		return err
+	}
+	keys := []string{r.recordsKey(matchID), r.matchKey(matchID)}
+	res, err := recordEventScript.Run(ctx, r.client, keys, event.EventID, data).Int()
+	if err != nil {
+		return fmt.Errorf("failed to record event %s for match %s. %w", event.EventID, matchID, err)
+	}
+	if res < 0 {
+		return ErrMatchNotFound
+	}
+	return nil
+}
+
+func (r *redisClient) GetEventRecords(ctx context.Context, matchID string) ([]models.EventRecord, error) {
+	data, err := r.client.HGetAll(ctx, r.recordsKey(matchID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event records for match %s. %w", matchID, err)
+	}
+	ids := slices.Sorted(maps.Keys(data))
+	events := make([]models.EventRecord, 0, len(ids))
+	for _, id := range ids {
+		e, err := models.DecodeEventRecord([]byte(data[id]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode event record %s for match %s. %w", id, matchID, err)
+		}
+		events = append(events, e)
 	}
+	return sortEventRecords(events), nil
+}
+
+func (r *redisClient) SetControl(ctx context.Context, control models.Control, matchID string, on bool) error {
+	var err error
+	if on {
+		err = r.client.SAdd(ctx, r.controlsKey(), control.Key(matchID)).Err()
+	} else {
+		err = r.client.SRem(ctx, r.controlsKey(), control.Key(matchID)).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set %s control for match %q. %w", control, matchID, err)
+	}
+	return nil
+}
+
+func (r *redisClient) GetControls(ctx context.Context) (models.Controls, error) {
+	keys, err := r.client.SMembers(ctx, r.controlsKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get controls. %w", err)
+	}
+	controls := models.Controls{}
+	for _, key := range keys {
+		control, matchID, err := models.ParseControlKey(key)
+		if err != nil {
+			return nil, err
+		}
+		controls.Set(control, matchID, true)
+	}
+	return controls, nil
+}
+
+func (r *redisClient) QuarantineEvent(ctx context.Context, event models.UnknownEvent) error {
+	data, err := json.Marshal(event)
 	if err != nil {
+		return fmt.Errorf("failed to marshal unknown event %s. %w", event.EventID, err)
+	}
+	_, err = r.client.HSet(ctx, r.unknownEventsKey(), event.MatchID+"/"+event.EventID, data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to quarantine event %s for match %s. %w", event.EventID, event.MatchID, err)
+	}
+	return nil
+}
+
+func (r *redisClient) GetUnknownEvents(ctx context.Context) ([]models.UnknownEvent, error) {
+	events, _, err := r.loadUnknownEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortUnknownEvents(events), nil
+}
+
+func (r *redisClient) DeleteUnknownEvents(ctx context.Context, eventType int) (int, error) {
+	events, fields, err := r.loadUnknownEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var matching []string
+	for i, e := range events {
+		if e.Type == eventType {
+			matching = append(matching, fields[i])
+		}
+	}
+	if len(matching) == 0 {
+		return 0, nil
+	}
+	deleted, err := r.client.HDel(ctx, r.unknownEventsKey(), matching...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unknown events of type %d. %w", eventType, err)
+	}
+	return int(deleted), nil
+}
+
+// loadUnknownEvents returns the quarantined events along with the hash field
+// each is stored under.
+func (r *redisClient) loadUnknownEvents(ctx context.Context) ([]models.UnknownEvent, []string, error) {
+	data, err := r.client.HGetAll(ctx, r.unknownEventsKey()).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get unknown events. %w", err)
+	}
+	fields := slices.Sorted(maps.Keys(data))
+	events := make([]models.UnknownEvent, 0, len(fields))
+	for _, field := range fields {
+		var e models.UnknownEvent
+		if err := json.Unmarshal([]byte(data[field]), &e); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal unknown event %s. %w", field, err)
+		}
+		events = append(events, e)
+	}
+	return events, fields, nil
+}
+
+func (r *redisClient) GetMatchEvents(ctx context.Context, matchID string) (models.Match, error) {
+	match, err := r.GetMatch(ctx, matchID)
+	if errors.Is(err, ErrMatchNotFound) {
 		return models.Match{}, nil
 	}
-	match, err := models.MatchFromRedis(val)
 	if err != nil {
-		return models.Match{}, fmt.Errorf("failed to unmarshal events. %w", err)
+		return models.Match{}, fmt.Errorf("failed to get events for match %s. %w", matchID, err)
 	}
 	return match, nil
 }
 
 func (r *redisClient) DeleteMatch(ctx context.Context, matchID string) error {
-	eventKey := getRedisMatchKey(matchID)
-	_, err := r.client.Del(ctx, eventKey).Result()
+	_, err := r.client.Del(ctx, r.matchKey(matchID), r.eventsKey(matchID), r.recordsKey(matchID)).Result()
 	if err != nil {
 		return fmt.Errorf("failed to delete from redis. %w", err)
 	}
+	_, err = r.client.SRem(ctx, r.indexKey(), matchID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to remove match from index. %w", err)
+	}
 	return nil
 }
 
@@ -92,31 +372,270 @@ func (r *redisClient) UpdateMatch(ctx context.Context, match models.Match) error
 	if err != nil {
 		return fmt.Errorf("failed to format match. %w", err)
 	}
-	key := getRedisMatchKey(match.MatchId)
+	delete(data, "events")
+	key := r.matchKey(match.MatchId)
 	_, err = r.client.HSet(ctx, key, data).Result()
 	if err != nil {
 		return fmt.Errorf("failed to update events in redis. %w", err)
 	}
+	// Activity pushes the expiry back for the match and everything stored
+	// alongside it
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, key, r.ttl)
+		pipe.Expire(ctx, r.eventsKey(match.MatchId), r.ttl)
+		pipe.Expire(ctx, r.recordsKey(match.MatchId), r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh match expiration. %w", err)
+	}
+	if err := r.addEvents(ctx, match); err != nil {
+		return err
+	}
+	_, err = r.client.SAdd(ctx, r.indexKey(), match.MatchId).Result()
+	if err != nil {
+		return fmt.Errorf("failed to add match to index. %w", err)
+	}
 	return nil
 }
 
+// GetAllMatches loads every match in the index with a single pipelined batch.
+// IDs whose hash has expired are pruned from the index.
 func (r *redisClient) GetAllMatches(ctx context.Context) ([]models.Match, error) {
-	keys, err := r.client.Keys(ctx, "match:*").Result()
+	matches, _, err := r.loadAllMatches(ctx)
+	if err != nil {
+		return []models.Match{}, err
+	}
+	return matches, nil
+}
+
+func (r *redisClient) ValidateMatches(ctx context.Context) ([]InvalidMatch, error) {
+	_, invalid, err := r.loadAllMatches(ctx)
+	return invalid, err
+}
+
+func (r *redisClient) loadAllMatches(ctx context.Context) ([]models.Match, []InvalidMatch, error) {
+	if err := r.indexLegacyMatches(ctx); err != nil {
+		return nil, nil, err
+	}
+	ids, err := r.client.SMembers(ctx, r.indexKey()).Result()
 	if err != nil {
-		return []models.Match{}, fmt.Errorf("failed to get keys from redis. %w", err)
+		return nil, nil, fmt.Errorf("failed to get match index from redis. %w", err)
 	}
+	if len(ids) == 0 {
+		return []models.Match{}, nil, nil
+	}
+
+	hashes := make([]*redis.MapStringStringCmd, len(ids))
+	events := make([]*redis.StringSliceCmd, len(ids))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			hashes[i] = pipe.HGetAll(ctx, r.matchKey(id))
+			events[i] = pipe.SMembers(ctx, r.eventsKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get matches from redis. %w", err)
+	}
+
 	matches := []models.Match{}
-	for _, k := range keys {
-		matchID := strings.TrimPrefix(k, "match:")
-		match, err := r.GetMatch(ctx, matchID)
-		if err != nil && !errors.Is(err, ErrMatchNotFound) {
-			return []models.Match{}, fmt.Errorf("failed to get match from the database. %w", err)
+	invalid := []InvalidMatch{}
+	stale := []any{}
+	for i, cmd := range hashes {
+		val := cmd.Val()
+		if len(val) == 0 {
+			stale = append(stale, ids[i])
+			continue
+		}
+		match, err := matchFromRedis(val, events[i].Val())
+		if err != nil {
+			invalid = append(invalid, InvalidMatch{MatchID: ids[i], Err: err})
+			continue
 		}
 		matches = append(matches, match)
 	}
-	return matches, nil
+	if len(stale) > 0 {
+		_, err = r.client.SRem(ctx, r.indexKey(), stale...).Result()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to prune expired matches from index. %w", err)
+		}
+	}
+	return matches, invalid, nil
+}
+
+// indexLegacyMatches adds match keys written before the index existed to the
+// index, using SCAN so Redis is not blocked. It runs once per keyspace, after
+// which matchIndexedKey is set.
+func (r *redisClient) indexLegacyMatches(ctx context.Context) error {
+	indexed, err := r.client.Exists(ctx, r.indexedKey()).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check match index marker. %w", err)
+	}
+	if indexed > 0 {
+		return nil
+	}
+	members := []any{}
+	iter := r.client.Scan(ctx, 0, r.matchKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		if isSubKey(iter.Val()) {
+			continue
+		}
+		members = append(members, strings.TrimPrefix(iter.Val(), r.matchKey("")))
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan for match keys. %w", err)
+	}
+	if len(members) > 0 {
+		_, err := r.client.SAdd(ctx, r.indexKey(), members...).Result()
+		if err != nil {
+			return fmt.Errorf("failed to add matches to index. %w", err)
+		}
+	}
+	if err := r.client.Set(ctx, r.indexedKey(), 1, 0).Err(); err != nil {
+		return fmt.Errorf("failed to set match index marker. %w", err)
+	}
+	return nil
+}
+
+func (r *redisClient) matchKey(matchID string) string {
+	return r.prefix + matchKeyPrefix + matchID
+}
+
+func (r *redisClient) eventsKey(matchID string) string {
+	return r.matchKey(matchID) + eventsKeySuffix
+}
+
+func (r *redisClient) recordsKey(matchID string) string {
+	return r.matchKey(matchID) + recordsKeySuffix
 }
 
-func getRedisMatchKey(matchID string) string {
-	return "match:" + matchID
+// isSubKey reports whether key holds data belonging to a match rather than
+// the match hash itself.
+func isSubKey(key string) bool {
+	return strings.HasSuffix(key, eventsKeySuffix) || strings.HasSuffix(key, recordsKeySuffix)
+}
+
+func (r *redisClient) indexKey() string {
+	return r.prefix + matchIndexKey
+}
+
+func (r *redisClient) indexedKey() string {
+	return r.prefix + matchIndexedKey
+}
+
+func (r *redisClient) controlsKey() string {
+	return r.prefix + controlsKey
+}
+
+func (r *redisClient) unknownEventsKey() string {
+	return r.prefix + unknownEventsKey
+}
+
+func (r *redisClient) addEvents(ctx context.Context, match models.Match) error {
+	if len(match.Events) == 0 {
+		return nil
+	}
+	ids := make([]any, len(match.Events))
+	for i, id := range match.Events {
+		ids[i] = id
+	}
+	keys := []string{r.eventsKey(match.MatchId), r.matchKey(match.MatchId)}
+	err := addEventsScript.Run(ctx, r.client, keys, ids...).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save events for match %s. %w", match.MatchId, err)
+	}
+	return nil
+}
+
+// matchFromRedis decodes a match hash along with its event set. Matches saved
+// before events had their own set keep them in the hash, so both are merged.
+func matchFromRedis(hash map[string]string, events []string) (models.Match, error) {
+	match, err := models.MatchFromRedis(hash)
+	if err != nil {
+		return models.Match{}, err
+	}
+	if match.Events == nil {
+		match.Events = []string{}
+	}
+	sort.Strings(events)
+	for _, id := range events {
+		if !slices.Contains(match.Events, id) {
+			match.Events = append(match.Events, id)
+		}
+	}
+	return match, nil
+}
+
+// MigrateUnprefixedKeys moves the keys written without a namespace into this
+// client's namespace: each match with its events and records, the controls
+// and the quarantined events. A match that already exists in the namespace is
+// left alone, while controls and quarantined events are merged, keeping the
+// namespace's copy of an event quarantined in both. The match index is then
+// rebuilt from the keys in the namespace. It returns the number of matches
+// moved.
+func (r *redisClient) MigrateUnprefixedKeys(ctx context.Context) (int, error) {
+	if r.prefix == "" {
+		return 0, nil
+	}
+	moved := 0
+	iter := r.client.Scan(ctx, 0, matchKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if isSubKey(key) {
+			// Moved along with their match
+			continue
+		}
+		matchID := strings.TrimPrefix(key, matchKeyPrefix)
+		ok, err := r.client.RenameNX(ctx, key, r.matchKey(matchID)).Result()
+		if err != nil {
+			return moved, fmt.Errorf("failed to rename %s. %w", key, err)
+		}
+		if !ok {
+			continue
+		}
+		for _, suffix := range []string{eventsKeySuffix, recordsKeySuffix} {
+			exists, err := r.client.Exists(ctx, key+suffix).Result()
+			if err != nil {
+				return moved, fmt.Errorf("failed to check %s. %w", key+suffix, err)
+			}
+			if exists == 0 {
+				continue
+			}
+			if err := r.client.Rename(ctx, key+suffix, r.matchKey(matchID)+suffix).Err(); err != nil {
+				return moved, fmt.Errorf("failed to rename %s. %w", key+suffix, err)
+			}
+		}
+		moved++
+	}
+	if err := iter.Err(); err != nil {
+		return moved, fmt.Errorf("failed to scan for unprefixed match keys. %w", err)
+	}
+
+	if err := r.client.SUnionStore(ctx, r.controlsKey(), r.controlsKey(), controlsKey).Err(); err != nil {
+		return moved, fmt.Errorf("failed to move unprefixed controls. %w", err)
+	}
+	unknown, err := r.client.HGetAll(ctx, unknownEventsKey).Result()
+	if err != nil {
+		return moved, fmt.Errorf("failed to get unprefixed unknown events. %w", err)
+	}
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for field, data := range unknown {
+			pipe.HSetNX(ctx, r.unknownEventsKey(), field, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return moved, fmt.Errorf("failed to move unprefixed unknown events. %w", err)
+	}
+	// The index is rebuilt rather than moved, since it may name matches that
+	// were not moved
+	err = r.client.Del(ctx, controlsKey, unknownEventsKey, matchIndexKey, matchIndexedKey, r.indexedKey()).Err()
+	if err != nil {
+		return moved, fmt.Errorf("failed to delete unprefixed keys. %w", err)
+	}
+	if err := r.indexLegacyMatches(ctx); err != nil {
+		return moved, err
+	}
+	return moved, nil
 }
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/imdevinc/fifa-bot/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/imdevinc/fifa-bot/pkg/database")
+
+// instrumentationHook traces Redis commands and counts the failed ones by
+// command name. A missing key (redis.Nil) is an answer rather than a failure
+// and is not counted.
+type instrumentationHook struct{}
+
+func (instrumentationHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			metrics.RedisErrors.WithLabelValues("dial").Inc()
+		}
+		return conn, err
+	}
+}
+
+func (instrumentationHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracer.Start(ctx, "redis "+cmd.Name(), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", cmd.Name()),
+		))
+		defer span.End()
+		err := next(ctx, cmd)
+		observeRedisCommand(span, cmd)
+		return err
+	}
+}
+
+func (instrumentationHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := tracer.Start(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.StringSlice("db.operations", names),
+		))
+		defer span.End()
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			observeRedisCommand(span, cmd)
+		}
+		return err
+	}
+}
+
+func observeRedisCommand(span trace.Span, cmd redis.Cmder) {
+	if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+		metrics.RedisErrors.WithLabelValues(cmd.Name()).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -2,6 +2,7 @@ package fifa
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	go_fifa "github.com/imdevinc/go-fifa"
@@ -48,6 +49,33 @@ var eventNameToValue = map[string]go_fifa.MatchEvent{
 	"Pending":          go_fifa.Pending,
 }
 
+var eventValueToName = func() map[go_fifa.MatchEvent]string {
+	names := make(map[go_fifa.MatchEvent]string, len(eventNameToValue))
+	for name, val := range eventNameToValue {
+		names[val] = name
+	}
+	return names
+}()
+
+// EventName returns the name of an event type as used in skip_events, or
+// "Unknown" for types the bot does not know.
+func EventName(evt go_fifa.MatchEvent) string {
+	if name, ok := eventValueToName[evt]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// EventNames returns the names accepted in skip_events, sorted.
+func EventNames() []string {
+	names := make([]string, 0, len(eventNameToValue))
+	for name := range eventNameToValue {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
 func ParseEventNames(names []string) (map[go_fifa.MatchEvent]bool, error) {
 	skipSet := make(map[go_fifa.MatchEvent]bool, len(names))
 	var unknown []string
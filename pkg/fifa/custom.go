@@ -0,0 +1,146 @@
+package fifa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+// DefaultCustomEventTemplate is used for a custom event without a template.
+const DefaultCustomEventTemplate = "{{.Icon}} {{.Description}}"
+
+// CustomEvent renders an event type the bot has no message for, as mapped in
+// the config's custom_events.
+type CustomEvent struct {
+	Name     string
+	Icon     string
+	template *template.Template
+}
+
+// CustomEventData is what a custom event template is executed with.
+type CustomEventData struct {
+	Name        string
+	Icon        string
+	Minute      string
+	Description string
+	// HomeTeam and AwayTeam are the team abbreviations, such as "ARG".
+	HomeTeam     string
+	AwayTeam     string
+	HomeTeamName string
+	AwayTeamName string
+	HomeFlag     string
+	AwayFlag     string
+	HomeGoals    int
+	AwayGoals    int
+	// Score is the score line used in goal messages, such as
+	// "1 ARG :flag-ar: : :flag-eg: EGY 0".
+	Score string
+}
+
+// NewCustomEvent parses text as a text/template and checks that it only uses
+// fields of CustomEventData. An empty text uses DefaultCustomEventTemplate.
+func NewCustomEvent(name string, icon string, text string) (CustomEvent, error) {
+	if text == "" {
+		text = DefaultCustomEventTemplate
+	}
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return CustomEvent{}, fmt.Errorf("failed to parse template. %w", err)
+	}
+	c := CustomEvent{Name: name, Icon: icon, template: tmpl}
+	// Fields are only looked up when the template runs, so run it once now
+	// rather than fail on the first live event
+	if _, err := c.render(go_fifa.TimelineEvent{}, &models.Match{}); err != nil {
+		return CustomEvent{}, err
+	}
+	return c, nil
+}
+
+func (c CustomEvent) render(evt go_fifa.TimelineEvent, opts *models.Match) (string, error) {
+	data := CustomEventData{
+		Name:         c.Name,
+		Icon:         c.Icon,
+		Minute:       evt.MatchMinute,
+		HomeTeam:     opts.HomeTeamAbbrev,
+		AwayTeam:     opts.AwayTeamAbbrev,
+		HomeTeamName: opts.HomeTeamName,
+		AwayTeamName: opts.AwayTeamName,
+		HomeFlag:     flagEmojis[opts.HomeTeamAbbrev],
+		AwayFlag:     flagEmojis[opts.AwayTeamAbbrev],
+		HomeGoals:    evt.HomeGoals,
+		AwayGoals:    evt.AwayGoals,
+	}
+	if len(evt.Description) > 0 {
+		data.Description = evt.Description[0].Description
+	}
+	data.Score = fmt.Sprintf("%d %s %s : %s %s %d", data.HomeGoals, data.HomeTeam, data.HomeFlag, data.AwayFlag, data.AwayTeam, data.AwayGoals)
+	var sb strings.Builder
+	if err := c.template.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render template. %w", err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// CustomEvents are the custom events of the config by event type.
+type CustomEvents map[go_fifa.MatchEvent]CustomEvent
+
+// Name returns the name of an event type, preferring a custom event's name
+// for types the bot does not know.
+func (c CustomEvents) Name(evt go_fifa.MatchEvent) string {
+	if custom, ok := c[evt]; ok {
+		return custom.Name
+	}
+	return EventName(evt)
+}
+
+// ProcessEvent is ProcessEvent with the custom events: an event of a type the
+// bot does not know, or has no message for, is rendered with the custom event
+// of its type, if there is one. Unknown types are otherwise sent as their bare
+// description when they have one. An event whose template fails is processed
+// as if it had no custom event.
+func (c CustomEvents) ProcessEvent(ctx context.Context, evt go_fifa.TimelineEvent, opts *models.Match, skipSet map[go_fifa.MatchEvent]bool) ProcessEventResult {
+	custom, ok := c[evt.Type]
+	if !ok || skipSet[evt.Type] {
+		return ProcessEvent(ctx, evt, opts, skipSet)
+	}
+	if _, known := eventValueToName[evt.Type]; known {
+		if result := ProcessEvent(ctx, evt, opts, skipSet); !result.IsUnknown {
+			return result
+		}
+	}
+	msg, err := custom.render(evt, opts)
+	if err != nil {
+		return ProcessEvent(ctx, evt, opts, skipSet)
+	}
+	if msg == "" {
+		return ProcessEventResult{}
+	}
+	return ProcessEventResult{SlackMessage: fmt.Sprintf("%s %s", evt.MatchMinute, msg)}
+}
+
+// ParseEventNamesWith is ParseEventNames that also accepts the names of the
+// custom events.
+func ParseEventNamesWith(names []string, custom CustomEvents) (map[go_fifa.MatchEvent]bool, error) {
+	customNames := make(map[string]go_fifa.MatchEvent, len(custom))
+	for evt, c := range custom {
+		customNames[c.Name] = evt
+	}
+	var rest []string
+	skipSet := make(map[go_fifa.MatchEvent]bool, len(names))
+	for _, name := range names {
+		if evt, ok := customNames[strings.TrimSpace(name)]; ok {
+			skipSet[evt] = true
+			continue
+		}
+		rest = append(rest, name)
+	}
+	builtIn, err := ParseEventNames(rest)
+	for evt := range builtIn {
+		skipSet[evt] = true
+	}
+	return skipSet, err
+}
@@ -2,6 +2,7 @@ package fifa
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
@@ -52,6 +53,31 @@ type ProcessEventResult struct {
 	IsUnknown bool
 }
 
+// NewEventRecord builds the stored form of an event and the result of
+// processing it.
+func NewEventRecord(evt go_fifa.TimelineEvent, result ProcessEventResult) models.EventRecord {
+	record := models.EventRecord{
+		Version:   models.EventRecordVersion,
+		EventID:   evt.Id,
+		Type:      int(evt.Type),
+		Period:    int(evt.Period),
+		Minute:    evt.MatchMinute,
+		TeamID:    evt.TeamId,
+		HomeGoals: evt.HomeGoals,
+		AwayGoals: evt.AwayGoals,
+		Timestamp: evt.Timestamp,
+		Message:   result.SlackMessage,
+		Unknown:   result.IsUnknown,
+	}
+	if len(evt.Description) > 0 {
+		record.Description = evt.Description[0].Description
+	}
+	if payload, err := json.Marshal(evt); err == nil {
+		record.Payload = payload
+	}
+	return record
+}
+
 func GetMatchEvents(ctx context.Context, fifaClient *go_fifa.Client, opts *models.Match) (MatchData, error) {
 	returnData := MatchData{
 		PendingEventFound: false,
@@ -1,17 +1,24 @@
 package fifa_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/imdevinc/fifa-bot/pkg/fifa"
 	"github.com/imdevinc/fifa-bot/pkg/models"
 	go_fifa "github.com/imdevinc/go-fifa"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+var update = flag.Bool("update", false, "update golden files in testdata")
+
 func TestLiveEvents(t *testing.T) {
 	client := go_fifa.Client{}
 	m := models.Match{
@@ -40,109 +47,188 @@ func TestLiveEvents(t *testing.T) {
 	}
 }
 
-func TestCustomEvents(t *testing.T) {
-	match := models.Match{
+func goldenMatch() models.Match {
+	return models.Match{
 		CompetitionId:  "17",
 		SeasonId:       "285023",
 		StageId:        "289287",
 		MatchId:        "400021535",
 		HomeTeamID:     "43971",
 		AwayTeamID:     "43926",
+		HomeTeamName:   "Switzerland",
+		AwayTeamName:   "Colombia",
 		HomeTeamAbbrev: "SUI",
 		AwayTeamAbbrev: "COL",
 	}
-	emptySkipSet := make(map[go_fifa.MatchEvent]bool)
-	events := []go_fifa.TimelineEvent{
-		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one scores!"}},
-		},
-		{
-			Type:        go_fifa.PenaltyMissed,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two missed"}},
-		},
-		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one scores!"}},
-		},
-		{
-			Type:        go_fifa.PenaltyMissed,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two missed"}},
-		},
-		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one scores!"}},
-		},
-		{
-			Type:        go_fifa.PenaltyMissed,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two missed"}},
-		},
-		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one scores!"}},
-		},
-		{
-			Type:        go_fifa.PenaltyMissed,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two missed"}},
-		},
-		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one scores!"}},
-		},
+}
+
+func evt(typ go_fifa.MatchEvent, period go_fifa.MatchPeriod, teamID string, minute string, home, away int, desc string) go_fifa.TimelineEvent {
+	e := go_fifa.TimelineEvent{
+		Type:        typ,
+		Period:      period,
+		TeamId:      teamID,
+		MatchMinute: minute,
+		HomeGoals:   home,
+		AwayGoals:   away,
+	}
+	if desc != "" {
+		e.Description = []go_fifa.LocaleDescription{{Locale: "en-GB", Description: desc}}
+	}
+	return e
+}
+
+func shootoutKick(teamID string, scored bool, desc string) go_fifa.TimelineEvent {
+	typ := go_fifa.PenaltyGoal
+	if !scored {
+		typ = go_fifa.PenaltyMissed
+	}
+	return evt(typ, go_fifa.ShootoutPeriod, teamID, "120'", 1, 1, desc)
+}
+
+func TestProcessEventGolden(t *testing.T) {
+	m := goldenMatch()
+	home, away := m.HomeTeamID, m.AwayTeamID
+	tests := []struct {
+		name   string
+		skip   []string
+		events []go_fifa.TimelineEvent
+	}{
 		{
-			Type:        go_fifa.PenaltyMissed,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two missed"}},
+			name: "regular_time",
+			events: []go_fifa.TimelineEvent{
+				evt(go_fifa.MatchStart, go_fifa.FirstPeriod, "", "0'", 0, 0, ""),
+				evt(go_fifa.GoalScore, go_fifa.FirstPeriod, home, "12'", 1, 0, "Player one scores!"),
+				evt(go_fifa.YellowCard, go_fifa.FirstPeriod, away, "20'", 1, 0, "Player two is booked"),
+				evt(go_fifa.Hydration, go_fifa.FirstPeriod, "", "30'", 1, 0, "Hydration break"),
+				evt(go_fifa.PenaltyAwarded, go_fifa.FirstPeriod, away, "38'", 1, 0, ""),
+				evt(go_fifa.PenaltyGoal, go_fifa.FirstPeriod, away, "39'", 1, 1, "Player three converts the penalty"),
+				evt(go_fifa.HalfEnd, go_fifa.FirstPeriod, "", "45'+2'", 1, 1, "End of first half"),
+				evt(go_fifa.Substitution, go_fifa.SecondPeriod, home, "46'", 1, 1, "Player four replaces player five"),
+				evt(go_fifa.DoubleYellow, go_fifa.SecondPeriod, away, "55'", 1, 1, "Player two is sent off after a second yellow"),
+				evt(go_fifa.OwnGoal, go_fifa.SecondPeriod, away, "61'", 2, 1, "Player six scores an own goal"),
+				evt(go_fifa.VARGoalDisallowed, go_fifa.SecondPeriod, away, "70'", 2, 1, "Goal disallowed after VAR review"),
+				evt(go_fifa.PenaltyMissed, go_fifa.SecondPeriod, home, "78'", 2, 1, "Player one misses the penalty"),
+				evt(go_fifa.PenaltyMissed2, go_fifa.SecondPeriod, home, "79'", 2, 1, "Player one hits the rebound wide"),
+				evt(go_fifa.RedCard, go_fifa.SecondPeriod, home, "85'", 2, 1, "Player seven is sent off"),
+				evt(go_fifa.MatchEnd, go_fifa.SecondPeriod, "", "90'+5'", 2, 1, "Full time"),
+			},
 		},
 		{
-			Type:        go_fifa.PenaltyMissed2,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one misses"}},
+			name: "shootout",
+			events: []go_fifa.TimelineEvent{
+				evt(go_fifa.PenaltyAwarded, go_fifa.ShootoutPeriod, home, "120'", 1, 1, ""),
+				shootoutKick(home, true, "Kick 1 scored"),
+				shootoutKick(away, true, "Kick 1 scored"),
+				shootoutKick(home, false, "Kick 2 missed"),
+				shootoutKick(away, true, "Kick 2 scored"),
+				shootoutKick(home, true, "Kick 3 scored"),
+				shootoutKick(away, false, "Kick 3 missed"),
+				shootoutKick(home, true, "Kick 4 scored"),
+				shootoutKick(away, true, "Kick 4 scored"),
+				shootoutKick(home, true, "Kick 5 scored"),
+				shootoutKick(away, true, "Kick 5 scored"),
+				shootoutKick(home, true, "Kick 6 scored"),
+				shootoutKick(away, true, "Kick 6 scored"),
+				shootoutKick(home, false, "Kick 7 missed"),
+				shootoutKick(away, true, "Kick 7 scored"),
+				evt(go_fifa.HalfEnd, go_fifa.ShootoutPeriod, "", "120'", 1, 1, ""),
+				evt(go_fifa.MatchEnd, go_fifa.ShootoutPeriod, "", "120'", 1, 1, ""),
+			},
 		},
 		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two scores"}},
+			name: "shootout_sudden_death",
+			events: []go_fifa.TimelineEvent{
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one scores!"),
+				evt(go_fifa.PenaltyMissed, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two missed"),
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one scores!"),
+				evt(go_fifa.PenaltyMissed, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two missed"),
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one scores!"),
+				evt(go_fifa.PenaltyMissed, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two missed"),
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one scores!"),
+				evt(go_fifa.PenaltyMissed, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two missed"),
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one scores!"),
+				evt(go_fifa.PenaltyMissed, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two missed"),
+				evt(go_fifa.PenaltyMissed2, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one misses"),
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two scores"),
+				evt(go_fifa.GoalScore, go_fifa.ShootoutPeriod, away, "120'", 0, 0, "Player one scores!"),
+				evt(go_fifa.PenaltyMissed, go_fifa.ShootoutPeriod, home, "120'", 0, 0, "Player two missed"),
+			},
 		},
 		{
-			Type:        go_fifa.GoalScore,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.AwayTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player one scores!"}},
+			name: "skip_set",
+			skip: []string{"YellowCard", "Substitution", "MatchStart"},
+			events: []go_fifa.TimelineEvent{
+				evt(go_fifa.MatchStart, go_fifa.FirstPeriod, "", "0'", 0, 0, ""),
+				evt(go_fifa.YellowCard, go_fifa.FirstPeriod, away, "20'", 0, 0, "Player two is booked"),
+				evt(go_fifa.GoalScore, go_fifa.FirstPeriod, home, "25'", 1, 0, "Player one scores!"),
+				evt(go_fifa.Substitution, go_fifa.SecondPeriod, home, "46'", 1, 0, "Player four replaces player five"),
+				evt(go_fifa.RedCard, go_fifa.SecondPeriod, home, "85'", 1, 0, "Player seven is sent off"),
+			},
 		},
 		{
-			Type:        go_fifa.PenaltyMissed,
-			Period:      go_fifa.ShootoutPeriod,
-			TeamId:      match.HomeTeamID,
-			Description: []go_fifa.LocaleDescription{{Locale: "en-GB", Description: "Player two missed"}},
+			name: "unknown",
+			events: []go_fifa.TimelineEvent{
+				evt(go_fifa.Offside, go_fifa.FirstPeriod, home, "10'", 0, 0, ""),
+				evt(go_fifa.CornerKick, go_fifa.FirstPeriod, home, "11'", 0, 0, "Corner kick"),
+				evt(go_fifa.Pending, go_fifa.FirstPeriod, "", "12'", 0, 0, ""),
+			},
 		},
 	}
-	for _, evt := range events {
-		result := fifa.ProcessEvent(context.Background(), evt, &match, emptySkipSet)
-		if len(result.SlackMessage) == 0 {
-			continue
-		}
-		t.Log(result.SlackMessage)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipSet, err := fifa.ParseEventNames(tt.skip)
+			require.NoError(t, err)
+			match := goldenMatch()
+			var buf bytes.Buffer
+			for i, e := range tt.events {
+				result := fifa.ProcessEvent(context.Background(), e, &match, skipSet)
+				line := result.SlackMessage
+				switch {
+				case result.IsUnknown:
+					line = "[unknown]"
+				case line == "":
+					line = "[skipped]"
+				}
+				fmt.Fprintf(&buf, "%02d %s\n", i, line)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				require.NoError(t, os.MkdirAll("testdata", 0o755))
+				require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err, "run go test with -update to create the golden file")
+			assert.Equal(t, string(want), buf.String())
+		})
 	}
 }
+
+func TestCustomEvents(t *testing.T) {
+	match := goldenMatch()
+	review, err := fifa.NewCustomEvent("VARReview", ":tv:", "")
+	require.NoError(t, err)
+	drinks, err := fifa.NewCustomEvent("DrinksBreak", "", "{{.HomeTeamName}} and {{.AwayTeamName}} take a break")
+	require.NoError(t, err)
+	custom := fifa.CustomEvents{999: review, 998: drinks}
+
+	result := custom.ProcessEvent(context.Background(), evt(999, go_fifa.FirstPeriod, "", "61'", 1, 0, "Goal under review"), &match, nil)
+	assert.Equal(t, fifa.ProcessEventResult{SlackMessage: "61' :tv: Goal under review"}, result)
+	result = custom.ProcessEvent(context.Background(), evt(998, go_fifa.FirstPeriod, "", "30'", 0, 0, ""), &match, nil)
+	assert.Equal(t, "30' "+match.HomeTeamName+" and "+match.AwayTeamName+" take a break", result.SlackMessage)
+
+	// Types without a custom event stay unknown, known types are unchanged
+	result = custom.ProcessEvent(context.Background(), evt(997, go_fifa.FirstPeriod, "", "31'", 0, 0, ""), &match, nil)
+	assert.True(t, result.IsUnknown)
+	known := evt(go_fifa.YellowCard, go_fifa.FirstPeriod, "", "32'", 0, 0, "Booked")
+	assert.Equal(t, fifa.ProcessEvent(context.Background(), known, &match, nil), custom.ProcessEvent(context.Background(), known, &match, nil))
+
+	skipSet, err := fifa.ParseEventNamesWith([]string{"DrinksBreak", "YellowCard", "Nope"}, custom)
+	assert.EqualError(t, err, "unknown event name(s): Nope")
+	assert.Equal(t, map[go_fifa.MatchEvent]bool{998: true, go_fifa.YellowCard: true}, skipSet)
+	result = custom.ProcessEvent(context.Background(), evt(998, go_fifa.FirstPeriod, "", "30'", 0, 0, ""), &match, skipSet)
+	assert.Equal(t, fifa.ProcessEventResult{}, result)
+
+	_, err = fifa.NewCustomEvent("Broken", "", "{{.Player}}")
+	assert.ErrorContains(t, err, "can't evaluate field Player")
+}
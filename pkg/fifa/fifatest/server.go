@@ -0,0 +1,310 @@
+// Package fifatest provides a scriptable fake of the FIFA live and timeline
+// endpoints used by go-fifa, for use in integration tests.
+package fifatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imdevinc/fifa-bot/pkg/models"
+	go_fifa "github.com/imdevinc/go-fifa"
+)
+
+type liveTeam struct {
+	Id           string                      `json:"IdTeam"`
+	Name         []go_fifa.LocaleDescription `json:"TeamName"`
+	Abbreviation string                      `json:"Abbreviation"`
+}
+
+type liveMatch struct {
+	CompetitionId string   `json:"IdCompetition"`
+	SeasonId      string   `json:"IdSeason"`
+	StageId       string   `json:"IdStage"`
+	MatchId       string   `json:"IdMatch"`
+	Home          liveTeam `json:"Home"`
+	Away          liveTeam `json:"Away"`
+}
+
+type liveResponse struct {
+	Results []liveMatch `json:"Results"`
+}
+
+type timelineResponse struct {
+	CompetitionId string                  `json:"IdCompetition"`
+	SeasonId      string                  `json:"IdSeason"`
+	StageId       string                  `json:"IdStage"`
+	MatchId       string                  `json:"IdMatch"`
+	Events        []go_fifa.TimelineEvent `json:"Event"`
+}
+
+type match struct {
+	info    models.Match
+	live    bool
+	events  []go_fifa.TimelineEvent
+	pending map[string]bool
+	delay   time.Duration
+}
+
+// Server is a fake FIFA API. Matches and events are scripted through its
+// methods and served back to any go-fifa client returned by Client.
+type Server struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	matches map[string]*match
+	order   []string
+	nextID  int
+	start   time.Time
+}
+
+// NewServer starts a fake FIFA API. Callers should Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		matches: map[string]*match{},
+		start:   time.Date(2026, time.June, 11, 19, 0, 0, 0, time.UTC),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Close shuts down the underlying HTTP server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL returns the base URL of the underlying HTTP server.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Client returns a go-fifa client whose requests are redirected to the fake
+// server, regardless of the host go-fifa would normally call.
+func (s *Server) Client() *go_fifa.Client {
+	target, _ := url.Parse(s.server.URL)
+	return &go_fifa.Client{
+		Client: &http.Client{
+			Transport: &rewriteTransport{target: target, next: s.server.Client().Transport},
+		},
+	}
+}
+
+// AddMatch adds a match to the live feed.
+func (s *Server) AddMatch(m models.Match) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.matches[m.MatchId]; !exists {
+		s.order = append(s.order, m.MatchId)
+	}
+	s.matches[m.MatchId] = &match{
+		info:    m,
+		live:    true,
+		pending: map[string]bool{},
+	}
+}
+
+// PushEvent appends an event to a match's timeline and returns its ID. If the
+// event has no ID or timestamp, one is assigned so that events are returned in
+// the order they were pushed.
+func (s *Server) PushEvent(matchID string, evt go_fifa.TimelineEvent) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		return "", fmt.Errorf("match %s not found", matchID)
+	}
+	s.nextID++
+	if evt.Id == "" {
+		evt.Id = fmt.Sprintf("%d", s.nextID)
+	}
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = s.start.Add(time.Duration(s.nextID) * time.Second)
+	}
+	m.events = append(m.events, evt)
+	return evt.Id, nil
+}
+
+// SetPending marks an event as pending, which is how FIFA reports events that
+// are still being entered. Clearing the flag restores the original type.
+func (s *Server) SetPending(matchID string, eventID string, pending bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+	if indexOf(m.events, eventID) < 0 {
+		return fmt.Errorf("event %s not found in match %s", eventID, matchID)
+	}
+	m.pending[eventID] = pending
+	return nil
+}
+
+// DeleteEvent removes an event from a match's timeline.
+func (s *Server) DeleteEvent(matchID string, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+	idx := indexOf(m.events, eventID)
+	if idx < 0 {
+		return fmt.Errorf("event %s not found in match %s", eventID, matchID)
+	}
+	m.events = append(m.events[:idx], m.events[idx+1:]...)
+	delete(m.pending, eventID)
+	return nil
+}
+
+// EndMatch appends a MatchEnd event carrying the last known score and period,
+// and removes the match from the live feed. The timeline stays available.
+func (s *Server) EndMatch(matchID string) (string, error) {
+	s.mu.Lock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		s.mu.Unlock()
+		return "", fmt.Errorf("match %s not found", matchID)
+	}
+	evt := go_fifa.TimelineEvent{Type: go_fifa.MatchEnd}
+	if len(m.events) > 0 {
+		last := m.events[len(m.events)-1]
+		evt.Period = last.Period
+		evt.HomeGoals = last.HomeGoals
+		evt.AwayGoals = last.AwayGoals
+		evt.MatchMinute = last.MatchMinute
+	}
+	m.live = false
+	s.mu.Unlock()
+	return s.PushEvent(matchID, evt)
+}
+
+// DropMatch removes a match from the live feed without sending a MatchEnd
+// event, as FIFA sometimes does. Its timeline is still served.
+func (s *Server) DropMatch(matchID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+	m.live = false
+	return nil
+}
+
+// SetTimelineDelay makes the timeline of a match respond only after d, as a
+// slow FIFA would.
+func (s *Server) SetTimelineDelay(matchID string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		return fmt.Errorf("match %s not found", matchID)
+	}
+	m.delay = d
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/live/football/now") {
+		s.handleLive(w)
+		return
+	}
+	if _, rest, found := strings.Cut(r.URL.Path, "/timelines/"); found {
+		parts := strings.Split(strings.Trim(rest, "/"), "/")
+		if len(parts) == 4 {
+			s.handleTimeline(w, parts[0], parts[1], parts[2], parts[3])
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) handleLive(w http.ResponseWriter) {
+	s.mu.Lock()
+	resp := liveResponse{Results: []liveMatch{}}
+	for _, id := range s.order {
+		m := s.matches[id]
+		if !m.live {
+			continue
+		}
+		resp.Results = append(resp.Results, liveMatch{
+			CompetitionId: m.info.CompetitionId,
+			SeasonId:      m.info.SeasonId,
+			StageId:       m.info.StageId,
+			MatchId:       m.info.MatchId,
+			Home:          team(m.info.HomeTeamID, m.info.HomeTeamName, m.info.HomeTeamAbbrev),
+			Away:          team(m.info.AwayTeamID, m.info.AwayTeamName, m.info.AwayTeamAbbrev),
+		})
+	}
+	s.mu.Unlock()
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleTimeline(w http.ResponseWriter, competitionID, seasonID, stageID, matchID string) {
+	s.mu.Lock()
+	m, exists := s.matches[matchID]
+	if !exists {
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	resp := timelineResponse{
+		CompetitionId: competitionID,
+		SeasonId:      seasonID,
+		StageId:       stageID,
+		MatchId:       matchID,
+		Events:        make([]go_fifa.TimelineEvent, 0, len(m.events)),
+	}
+	for _, evt := range m.events {
+		if m.pending[evt.Id] {
+			evt.Type = go_fifa.Pending
+		}
+		resp.Events = append(resp.Events, evt)
+	}
+	delay := m.delay
+	s.mu.Unlock()
+	time.Sleep(delay)
+	writeJSON(w, resp)
+}
+
+func team(id, name, abbrev string) liveTeam {
+	return liveTeam{
+		Id:           id,
+		Name:         []go_fifa.LocaleDescription{{Locale: "en-GB", Description: name}},
+		Abbreviation: abbrev,
+	}
+}
+
+func indexOf(events []go_fifa.TimelineEvent, eventID string) int {
+	for i, evt := range events {
+		if evt.Id == eventID {
+			return i
+		}
+	}
+	return -1
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,59 @@
+package helper
+
+import (
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+const redacted = "[REDACTED]"
+
+// Redactor replaces known secret values in text before it is logged or
+// served. A nil Redactor leaves text as it is.
+type Redactor struct {
+	secrets atomic.Pointer[[]string]
+}
+
+// SetSecrets replaces the values to redact. Empty values are ignored.
+func (r *Redactor) SetSecrets(secrets ...string) {
+	var nonEmpty []string
+	for _, s := range secrets {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	r.secrets.Store(&nonEmpty)
+}
+
+// Redact returns s with every secret replaced by [REDACTED].
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	secrets := r.secrets.Load()
+	if secrets == nil {
+		return s
+	}
+	for _, secret := range *secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// ReplaceAttr redacts log attributes, including the message and errors. It is
+// meant for slog.HandlerOptions.
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); r.Redact(s) != s {
+			a.Value = slog.StringValue(r.Redact(s))
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			if s := err.Error(); r.Redact(s) != s {
+				a.Value = slog.StringValue(r.Redact(s))
+			}
+		}
+	}
+	return a
+}
@@ -1,32 +1,55 @@
 package helper
 
 import (
-	"github.com/getsentry/sentry-go"
-	log "github.com/sirupsen/logrus"
-)
+	"context"
+	"fmt"
+	"strings"
 
-type SentryConfig struct {
-	DSN             string
-	TraceSampleRate float64
-	Release         string
-	Debug           bool
-}
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
 
-func InitLogging(logLevel log.Level) {
-	log.SetFormatter(&log.JSONFormatter{})
-	log.SetLevel(logLevel)
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector, either host:port or a full URL.
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+	ServiceName string
 }
 
-func InitSentry(config SentryConfig) error {
-	err := sentry.Init(sentry.ClientOptions{
-		Dsn:              config.DSN,
-		Debug:            config.Debug,
-		TracesSampleRate: config.TraceSampleRate,
-		Release:          config.Release,
-	})
+// InitTracing installs a global tracer provider that exports spans over
+// OTLP/HTTP. The returned function flushes pending spans and should be called
+// on shutdown.
+func InitTracing(ctx context.Context, config TracingConfig) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{}
+	if strings.Contains(config.Endpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(config.Endpoint))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(config.Endpoint))
+	}
+	if config.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter. %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", config.ServiceName),
+	))
 	if err != nil {
-		log.WithError(err).Error("failed to initialize sentry")
-		return err
+		return nil, fmt.Errorf("failed to build trace resource. %w", err)
 	}
-	return nil
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
 }
@@ -0,0 +1,129 @@
+// Package leader implements a Redis lease so that only one of several
+// replicas polls FIFA and sends notifications at a time.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript takes or renews the lease. KEYS[1] holds the ID of the current
+// holder. It returns 1 if ARGV[1] holds the lease, or 0 if another instance
+// does.
+var acquireScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// releaseScript deletes the lease only if it is still held by ARGV[1].
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lease is a lease-based leader lock held in Redis. An instance that stops
+// renewing loses the lease once its TTL runs out, so a standby takes over
+// within TTL plus one renewal interval. The lease is not a fencing mechanism:
+// two instances may briefly both believe they lead, which is safe because
+// events are claimed in the database before they are announced.
+type Lease struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+
+	mu         sync.Mutex
+	validUntil time.Time
+}
+
+// NewLease returns a lease stored at key. id must be unique per instance.
+func NewLease(client *redis.Client, key string, id string, ttl time.Duration) *Lease {
+	return &Lease{
+		client: client,
+		key:    key,
+		id:     id,
+		ttl:    ttl,
+	}
+}
+
+// TryAcquire takes the lease if it is free, or renews it if this instance
+// already holds it.
+func (l *Lease) TryAcquire(ctx context.Context) (bool, error) {
+	start := time.Now()
+	held, err := acquireScript.Run(ctx, l.client, []string{l.key}, l.id, l.ttl.Milliseconds()).Int64()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		// Keep serving until the lease we know about runs out; another
+		// instance cannot take it before then either.
+		return time.Now().Before(l.validUntil), fmt.Errorf("failed to acquire lease %s. %w", l.key, err)
+	}
+	if held == 0 {
+		l.validUntil = time.Time{}
+		return false, nil
+	}
+	// Measured from before the call, so the local view never outlives Redis's
+	l.validUntil = start.Add(l.ttl)
+	return true, nil
+}
+
+// Release gives up the lease if this instance holds it.
+func (l *Lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	l.validUntil = time.Time{}
+	l.mu.Unlock()
+	err := releaseScript.Run(ctx, l.client, []string{l.key}, l.id).Err()
+	if err != nil {
+		return fmt.Errorf("failed to release lease %s. %w", l.key, err)
+	}
+	return nil
+}
+
+// IsLeader reports whether this instance holds an unexpired lease.
+func (l *Lease) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.validUntil)
+}
+
+// Run acquires and renews the lease every third of its TTL until ctx is
+// cancelled, then releases it.
+func (l *Lease) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	wasLeader := false
+	for {
+		leader, err := l.TryAcquire(ctx)
+		if err != nil {
+			slog.Error("failed to renew leader lease", "key", l.key, "error", err)
+		}
+		if leader != wasLeader {
+			slog.Info("leadership changed", "key", l.key, "instance", l.id, "leader", leader)
+			wasLeader = leader
+		}
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := l.Release(releaseCtx); err != nil {
+				slog.Error("failed to release leader lease", "key", l.key, "error", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
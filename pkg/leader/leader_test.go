@@ -0,0 +1,109 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestLeaseTakeover(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	ttl := time.Minute
+	a := NewLease(newClient(t, mr), "leader", "a", ttl)
+	b := NewLease(newClient(t, mr), "leader", "b", ttl)
+
+	ok, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, a.IsLeader())
+
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, b.IsLeader())
+
+	// Renewing pushes the expiry back
+	mr.FastForward(ttl / 2)
+	ok, err = a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	mr.FastForward(ttl / 2)
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// a stops renewing
+	mr.FastForward(ttl)
+	ok, err = b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, b.IsLeader())
+
+	ok, err = a.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, a.IsLeader())
+}
+
+func TestLeaseRelease(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	a := NewLease(newClient(t, mr), "leader", "a", time.Minute)
+	b := NewLease(newClient(t, mr), "leader", "b", time.Minute)
+
+	_, err := a.TryAcquire(ctx)
+	require.NoError(t, err)
+	// Releasing a lease held by someone else does nothing
+	require.NoError(t, b.Release(ctx))
+	assert.Equal(t, "a", mustGet(t, mr, "leader"))
+
+	require.NoError(t, a.Release(ctx))
+	assert.False(t, a.IsLeader())
+	ok, err := b.TryAcquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestLeaseRunHandsOverOnShutdown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ttl := 150 * time.Millisecond
+	a := NewLease(newClient(t, mr), "leader", "a", ttl)
+	b := NewLease(newClient(t, mr), "leader", "b", ttl)
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		a.Run(ctxA)
+		close(doneA)
+	}()
+	require.Eventually(t, a.IsLeader, time.Second, 10*time.Millisecond)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go b.Run(ctxB)
+	time.Sleep(ttl)
+	assert.False(t, b.IsLeader(), "the standby must wait while the leader renews")
+
+	cancelA()
+	<-doneA
+	assert.False(t, a.IsLeader())
+	assert.Eventually(t, b.IsLeader, time.Second, 10*time.Millisecond)
+}
+
+func mustGet(t *testing.T, mr *miniredis.Miniredis, key string) string {
+	val, err := mr.Get(key)
+	require.NoError(t, err)
+	return val
+}
@@ -0,0 +1,115 @@
+// Package metrics holds the Prometheus collectors the bot records into and
+// serves on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "fifa_bot"
+
+// Outcomes recorded against EventsTotal.
+const (
+	EventSeen    = "seen"
+	EventSkipped = "skipped"
+	EventUnknown = "unknown"
+	EventPosted  = "posted"
+)
+
+var (
+	// Registry holds every collector below along with the Go and process
+	// collectors.
+	Registry = prometheus.NewRegistry()
+
+	FIFARequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fifa_request_duration_seconds",
+		Help:      "Latency of FIFA API requests by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	FIFARequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fifa_request_errors_total",
+		Help:      "FIFA API requests that failed, by endpoint.",
+	}, []string{"endpoint"})
+
+	EventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Match events by event type and outcome (seen, skipped, unknown or posted).",
+	}, []string{"type", "outcome"})
+
+	NotificationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "notification_duration_seconds",
+		Help:      "Latency of sending a notification by destination.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"destination"})
+
+	NotificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_failures_total",
+		Help:      "Notifications that could not be sent, by destination.",
+	}, []string{"destination"})
+
+	RedisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Redis operations that failed, by operation.",
+	}, []string{"operation"})
+
+	TrackedMatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracked_matches",
+		Help:      "Matches currently being polled.",
+	})
+
+	EventPostDelay = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_post_delay_seconds",
+		Help:      "Time from an event's FIFA timestamp to its notification being sent.",
+		Buckets:   []float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600},
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		FIFARequestDuration,
+		FIFARequestErrors,
+		EventsTotal,
+		NotificationDuration,
+		NotificationFailures,
+		RedisErrors,
+		TrackedMatches,
+		EventPostDelay,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveFIFARequest records a FIFA API request that started at start.
+func ObserveFIFARequest(endpoint string, start time.Time, err error) {
+	FIFARequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		FIFARequestErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// ObserveNotification records a notification send that started at start.
+func ObserveNotification(destination string, start time.Time, err error) {
+	NotificationDuration.WithLabelValues(destination).Observe(time.Since(start).Seconds())
+	if err != nil {
+		NotificationFailures.WithLabelValues(destination).Inc()
+	}
+}
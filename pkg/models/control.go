@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Control is an admin control over how the bot handles a match. Controls are
+// kept in storage, so they apply to every instance sharing it and survive a
+// restart.
+type Control string
+
+const (
+	// ControlForced keeps a match tracked while FIFA does not list it as live.
+	ControlForced Control = "forced"
+	// ControlUntracked keeps a live match from being tracked again.
+	ControlUntracked Control = "untracked"
+	// ControlPaused stops the notifications of a match, or of every match
+	// when set for an empty match ID.
+	ControlPaused Control = "paused"
+	// ControlReset asks the instance tracking a match to forget its processed
+	// events before it next polls the match.
+	ControlReset Control = "reset"
+)
+
+// Controls are the controls that are on, by control and match ID.
+type Controls map[Control]map[string]bool
+
+// Has reports whether control is on for matchID.
+func (c Controls) Has(control Control, matchID string) bool {
+	return c[control][matchID]
+}
+
+// Set turns control on or off for matchID.
+func (c Controls) Set(control Control, matchID string, on bool) {
+	if !on {
+		delete(c[control], matchID)
+		return
+	}
+	if c[control] == nil {
+		c[control] = map[string]bool{}
+	}
+	c[control][matchID] = true
+}
+
+// Clone returns a copy of c that can be changed on its own.
+func (c Controls) Clone() Controls {
+	cloned := make(Controls, len(c))
+	for control, ids := range c {
+		for id := range ids {
+			cloned.Set(control, id, true)
+		}
+	}
+	return cloned
+}
+
+// Key encodes a control and match ID as a single string, for backends that
+// keep controls in a flat set.
+func (c Control) Key(matchID string) string {
+	return string(c) + "/" + matchID
+}
+
+// ParseControlKey decodes a string written by Control.Key.
+func ParseControlKey(key string) (Control, string, error) {
+	control, matchID, found := strings.Cut(key, "/")
+	if !found {
+		return "", "", fmt.Errorf("invalid control %q", key)
+	}
+	return Control(control), matchID, nil
+}
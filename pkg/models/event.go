@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventRecordVersion is the version written with every stored event record.
+// Bump it, and teach DecodeEventRecord to upgrade the previous version, when
+// the stored fields change meaning.
+const EventRecordVersion = 1
+
+// EventRecord is a processed timeline event as kept by the storage backends.
+type EventRecord struct {
+	Version     int       `json:"v"`
+	EventID     string    `json:"id"`
+	Type        int       `json:"type"`
+	Period      int       `json:"period"`
+	Minute      string    `json:"minute,omitempty"`
+	TeamID      string    `json:"team,omitempty"`
+	HomeGoals   int       `json:"home"`
+	AwayGoals   int       `json:"away"`
+	Timestamp   time.Time `json:"ts,omitzero"`
+	Description string    `json:"desc,omitempty"`
+	// Message is the rendered notification, empty if the event was skipped.
+	Message string `json:"msg,omitempty"`
+	Unknown bool   `json:"unknown,omitempty"`
+	// Payload is the raw event JSON as received from FIFA. It is only kept by
+	// the Postgres backend and left out of the encoded record.
+	Payload []byte `json:"-"`
+}
+
+// Encode returns the compact form of the record stored alongside a match.
+func (e EventRecord) Encode() ([]byte, error) {
+	if e.Version == 0 {
+		e.Version = EventRecordVersion
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event record %s. %w", e.EventID, err)
+	}
+	return data, nil
+}
+
+// DecodeEventRecord parses a record written by Encode. Records written by a
+// newer version of the bot are rejected rather than half read.
+func DecodeEventRecord(data []byte) (EventRecord, error) {
+	var record EventRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return EventRecord{}, fmt.Errorf("failed to unmarshal event record. %w", err)
+	}
+	if record.Version < 1 || record.Version > EventRecordVersion {
+		return EventRecord{}, fmt.Errorf("unsupported event record version %d for event %s", record.Version, record.EventID)
+	}
+	return record, nil
+}
@@ -3,6 +3,10 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type Match struct {
@@ -39,58 +43,61 @@ func (m *Match) GetMap() (map[string]any, error) {
 		return map[string]any{}, fmt.Errorf("failed to marshal events. %w", err)
 	}
 	result["events"] = string(eventsJSON)
+	result[schemaVersionField] = MatchSchemaVersion
 	return result, nil
 }
 
+// MatchFromRedis decodes a match from its flattened hash fields, upgrading
+// records written by older versions first. Fields are matched to the struct by
+// their json tag, so a new field only needs adding to Match. A record missing
+// any of the IDs needed to poll FIFA is an error rather than a half-filled
+// match.
 func MatchFromRedis(data map[string]string) (Match, error) {
-	match := Match{}
-	if val, exists := data["id"]; exists {
-		match.Id = val
-	}
-	if val, exists := data["competition_id"]; exists {
-		match.CompetitionId = val
-	}
-	if val, exists := data["season_id"]; exists {
-		match.SeasonId = val
-	}
-	if val, exists := data["stage_id"]; exists {
-		match.StageId = val
-	}
-	if val, exists := data["match_id"]; exists {
-		match.MatchId = val
-	}
-	if val, exists := data["last_event"]; exists {
-		match.LastEvent = val
-	}
-	if val, exists := data["home_team_name"]; exists {
-		match.HomeTeamName = val
-	}
-	if val, exists := data["home_team_abbrev"]; exists {
-		match.HomeTeamAbbrev = val
-	}
-	if val, exists := data["away_team_name"]; exists {
-		match.AwayTeamName = val
-	}
-	if val, exists := data["away_team_abbrev"]; exists {
-		match.AwayTeamAbbrev = val
-	}
-	if val, exists := data["home_team_penalty_results"]; exists {
-		match.HomeTeamPenaltyResults = val
-	}
-	if val, exists := data["away_team_penalty_results"]; exists {
-		match.AwayTeamPenaltyResults = val
-	}
-	if val, exists := data["home_team_id"]; exists {
-		match.HomeTeamID = val
+	fields, err := upgradeMatchFields(data)
+	if err != nil {
+		return Match{}, err
 	}
-	if val, exists := data["away_team_id"]; exists {
-		match.AwayTeamID = val
+	match := Match{}
+	v := reflect.ValueOf(&match).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		val, exists := fields[name]
+		if !exists {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(val)
+		case reflect.Int:
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return Match{}, fmt.Errorf("failed to parse %s. %w", name, err)
+			}
+			field.SetInt(int64(n))
+		case reflect.Slice:
+			if err := json.Unmarshal([]byte(val), field.Addr().Interface()); err != nil {
+				return Match{}, fmt.Errorf("failed to unmarshal %s. %w", name, err)
+			}
+		default:
+			return Match{}, fmt.Errorf("unsupported field type %s for %s", field.Kind(), name)
+		}
 	}
-	if val, exists := data["events"]; exists {
-		err := json.Unmarshal([]byte(val), &match.Events)
-		if err != nil {
-			return Match{}, fmt.Errorf("failed to unmarshal events. %w", err)
+	var missing []string
+	for name, val := range map[string]string{
+		"match_id":       match.MatchId,
+		"competition_id": match.CompetitionId,
+		"season_id":      match.SeasonId,
+		"stage_id":       match.StageId,
+	} {
+		if val == "" {
+			missing = append(missing, name)
 		}
 	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return Match{}, fmt.Errorf("match record is missing %s", strings.Join(missing, ", "))
+	}
 	return match, nil
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+)
+
+// MatchSchemaVersion is the layout GetMap writes. Records without a version
+// field were written before versioning and are version 1.
+const MatchSchemaVersion = 2
+
+const schemaVersionField = "schema_version"
+
+// matchMigrations upgrades stored match fields from the version they are keyed
+// by to the next one. When changing the stored layout, bump MatchSchemaVersion
+// and add the step from the previous version here.
+var matchMigrations = map[int]func(fields map[string]string) error{
+	1: migrateMatchV1,
+}
+
+// migrateMatchV1 cleans up the events field of unversioned records. Some were
+// written with an empty string or "null" when a match had no events yet.
+func migrateMatchV1(fields map[string]string) error {
+	if events, exists := fields["events"]; exists && (events == "" || events == "null") {
+		delete(fields, "events")
+	}
+	return nil
+}
+
+// MatchFieldsVersion returns the schema version of stored match fields.
+func MatchFieldsVersion(fields map[string]string) (int, error) {
+	val, exists := fields[schemaVersionField]
+	if !exists {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q. %w", schemaVersionField, val, err)
+	}
+	return version, nil
+}
+
+// upgradeMatchFields returns a copy of fields migrated to MatchSchemaVersion.
+// Records written by a newer version are rejected rather than half read.
+func upgradeMatchFields(fields map[string]string) (map[string]string, error) {
+	version, err := MatchFieldsVersion(fields)
+	if err != nil {
+		return nil, err
+	}
+	if version > MatchSchemaVersion {
+		return nil, fmt.Errorf("match record has schema version %d, newer than the supported %d", version, MatchSchemaVersion)
+	}
+	upgraded := maps.Clone(fields)
+	for ; version < MatchSchemaVersion; version++ {
+		migrate, exists := matchMigrations[version]
+		if !exists {
+			return nil, fmt.Errorf("no migration from match schema version %d", version)
+		}
+		if err := migrate(upgraded); err != nil {
+			return nil, fmt.Errorf("failed to migrate match from schema version %d. %w", version, err)
+		}
+	}
+	upgraded[schemaVersionField] = strconv.Itoa(MatchSchemaVersion)
+	return upgraded, nil
+}
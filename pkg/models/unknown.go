@@ -0,0 +1,63 @@
+package models
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// UnknownEvent is a timeline event of a type the bot has no message for, kept
+// with the JSON received from FIFA so the type can be studied and mapped in
+// custom_events.
+type UnknownEvent struct {
+	MatchID       string          `json:"match_id"`
+	CompetitionID string          `json:"competition_id"`
+	EventID       string          `json:"event_id"`
+	Type          int             `json:"type"`
+	Minute        string          `json:"minute,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	SeenAt        time.Time       `json:"seen_at"`
+}
+
+// UnknownEventType sums up the quarantined events of one type.
+type UnknownEventType struct {
+	Type      int       `json:"type"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Matches are the IDs of the matches the type was seen in, sorted.
+	Matches []string `json:"matches"`
+	// Latest is the most recently seen event of the type.
+	Latest UnknownEvent `json:"latest"`
+}
+
+// GroupUnknownEvents sums up events by type, ordered by type.
+func GroupUnknownEvents(events []UnknownEvent) []UnknownEventType {
+	byType := map[int]*UnknownEventType{}
+	for _, e := range events {
+		group, ok := byType[e.Type]
+		if !ok {
+			group = &UnknownEventType{Type: e.Type, FirstSeen: e.SeenAt, LastSeen: e.SeenAt, Latest: e}
+			byType[e.Type] = group
+		}
+		group.Count++
+		if e.SeenAt.Before(group.FirstSeen) {
+			group.FirstSeen = e.SeenAt
+		}
+		if !e.SeenAt.Before(group.LastSeen) {
+			group.LastSeen = e.SeenAt
+			group.Latest = e
+		}
+		if !slices.Contains(group.Matches, e.MatchID) {
+			group.Matches = append(group.Matches, e.MatchID)
+		}
+	}
+	groups := make([]UnknownEventType, 0, len(byType))
+	for _, group := range byType {
+		slices.Sort(group.Matches)
+		groups = append(groups, *group)
+	}
+	slices.SortFunc(groups, func(x, y UnknownEventType) int { return cmp.Compare(x.Type, y.Type) })
+	return groups
+}
@@ -0,0 +1,140 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Membership tracks the live workers in a Redis sorted set. Each worker
+// scores its own ID with the time its heartbeat runs out, and drops members
+// whose heartbeat has passed. Scores use the Redis server clock so workers on
+// different hosts agree on who has expired.
+type Membership struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+
+	mu         sync.Mutex
+	members    []string
+	ring       *Ring
+	validUntil time.Time
+}
+
+// NewMembership returns a membership stored at key. id must be unique per
+// worker.
+func NewMembership(client *redis.Client, key string, id string, ttl time.Duration) *Membership {
+	return &Membership{
+		client: client,
+		key:    key,
+		id:     id,
+		ttl:    ttl,
+		ring:   NewRing(nil),
+	}
+}
+
+// Heartbeat refreshes this worker's entry, drops expired workers and rebuilds
+// the ring from the remaining members. It reports whether the membership
+// changed. On error the previous ring is kept until this worker's own entry
+// would have expired.
+func (m *Membership) Heartbeat(ctx context.Context) (bool, error) {
+	start := time.Now()
+	now, err := m.client.Time(ctx).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to get redis time. %w", err)
+	}
+	var members *redis.StringSliceCmd
+	_, err = m.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, m.key, redis.Z{Score: float64(now.Add(m.ttl).UnixMilli()), Member: m.id})
+		pipe.ZRemRangeByScore(ctx, m.key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		// Keep the set itself from outliving every worker
+		pipe.PExpire(ctx, m.key, m.ttl*2)
+		members = pipe.ZRange(ctx, m.key, 0, -1)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update workers in %s. %w", m.key, err)
+	}
+	changed := m.setMembers(members.Val())
+	m.mu.Lock()
+	m.validUntil = start.Add(m.ttl)
+	m.mu.Unlock()
+	return changed, nil
+}
+
+// Leave removes this worker so the others pick up its matches on their next
+// heartbeat instead of waiting for it to expire.
+func (m *Membership) Leave(ctx context.Context) error {
+	m.setMembers(nil)
+	m.mu.Lock()
+	m.validUntil = time.Time{}
+	m.mu.Unlock()
+	err := m.client.ZRem(ctx, m.key, m.id).Err()
+	if err != nil {
+		return fmt.Errorf("failed to leave %s. %w", m.key, err)
+	}
+	return nil
+}
+
+// Owns reports whether this worker is responsible for matchID. A worker whose
+// last successful heartbeat is older than the TTL owns nothing, since the
+// others have dropped it by then.
+func (m *Membership) Owns(matchID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !time.Now().Before(m.validUntil) {
+		return false
+	}
+	return m.ring.Owner(matchID) == m.id
+}
+
+// Members returns the workers in the current ring.
+func (m *Membership) Members() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.members)
+}
+
+func (m *Membership) setMembers(members []string) bool {
+	slices.Sort(members)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.Equal(members, m.members) {
+		return false
+	}
+	m.members = members
+	m.ring = NewRing(members)
+	return true
+}
+
+// Run heartbeats every third of the TTL until ctx is cancelled, then leaves.
+func (m *Membership) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	for {
+		changed, err := m.Heartbeat(ctx)
+		if err != nil {
+			slog.Error("failed to heartbeat worker membership", "key", m.key, "error", err)
+		}
+		if changed {
+			slog.Info("worker membership changed, rebalancing matches", "key", m.key, "worker", m.id, "workers", m.Members())
+		}
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := m.Leave(leaveCtx); err != nil {
+				slog.Error("failed to leave worker membership", "key", m.key, "error", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package shard spreads matches across several workers. Workers announce
+// themselves in Redis and each one builds the same consistent hash ring from
+// the live membership, so they agree on who owns a match without talking to
+// each other.
+package shard
+
+import (
+	"hash/crc32"
+	"slices"
+	"strconv"
+)
+
+// replicas is the number of points each worker gets on the ring. More points
+// spread matches more evenly at the cost of a larger ring.
+const replicas = 64
+
+// Ring is a consistent hash ring. Adding or removing a worker only moves the
+// matches that hash next to that worker's points.
+type Ring struct {
+	points []uint32
+	owners map[uint32]string
+}
+
+// NewRing returns a ring over the given workers.
+func NewRing(workers []string) *Ring {
+	r := &Ring{
+		points: make([]uint32, 0, len(workers)*replicas),
+		owners: make(map[uint32]string, len(workers)*replicas),
+	}
+	for _, w := range workers {
+		for i := range replicas {
+			p := hash(w + "#" + strconv.Itoa(i))
+			// On the rare collision keep the smaller ID so every worker
+			// builds the same ring regardless of member order
+			owner, exists := r.owners[p]
+			if !exists {
+				r.points = append(r.points, p)
+			} else if owner < w {
+				continue
+			}
+			r.owners[p] = w
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// Owner returns the worker responsible for key, or an empty string if the
+// ring has no workers.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hash(s string) uint32 {
+	return crc32.ChecksumIEEE([]byte(s))
+}
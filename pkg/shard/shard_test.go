@@ -0,0 +1,155 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func matchIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("4000%04d", i)
+	}
+	return ids
+}
+
+func TestRingSpreadsMatches(t *testing.T) {
+	ring := NewRing([]string{"a", "b", "c"})
+	counts := map[string]int{}
+	for _, id := range matchIDs(3000) {
+		counts[ring.Owner(id)]++
+	}
+	assert.Len(t, counts, 3)
+	for worker, n := range counts {
+		assert.Greater(t, n, 600, "worker %s only owns %d of 3000 matches", worker, n)
+	}
+}
+
+func TestRingIgnoresMemberOrder(t *testing.T) {
+	first := NewRing([]string{"a", "b", "c"})
+	second := NewRing([]string{"c", "a", "b"})
+	for _, id := range matchIDs(500) {
+		assert.Equal(t, first.Owner(id), second.Owner(id))
+	}
+}
+
+func TestRingOnlyMovesMatchesToNewWorker(t *testing.T) {
+	before := NewRing([]string{"a", "b"})
+	after := NewRing([]string{"a", "b", "c"})
+	moved := 0
+	for _, id := range matchIDs(1000) {
+		if before.Owner(id) == after.Owner(id) {
+			continue
+		}
+		moved++
+		assert.Equal(t, "c", after.Owner(id), "match %s moved between existing workers", id)
+	}
+	assert.Greater(t, moved, 0)
+}
+
+func TestRingWithoutWorkers(t *testing.T) {
+	assert.Equal(t, "", NewRing(nil).Owner("1"))
+}
+
+func newClient(t *testing.T, mr *miniredis.Miniredis) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// owners returns, for each match, the workers that claim it.
+func owners(workers []*Membership, ids []string) map[string][]string {
+	result := map[string][]string{}
+	for _, id := range ids {
+		for _, w := range workers {
+			if w.Owns(id) {
+				result[id] = append(result[id], w.id)
+			}
+		}
+	}
+	return result
+}
+
+func TestMembershipRebalances(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Now()
+	mr.SetTime(now)
+	ttl := time.Minute
+	a := NewMembership(newClient(t, mr), "workers", "a", ttl)
+	b := NewMembership(newClient(t, mr), "workers", "b", ttl)
+	ids := matchIDs(50)
+
+	assert.False(t, a.Owns(ids[0]), "a worker owns nothing before its first heartbeat")
+	changed, err := a.Heartbeat(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	for _, id := range ids {
+		assert.True(t, a.Owns(id))
+	}
+
+	// b joins
+	_, err = b.Heartbeat(ctx)
+	require.NoError(t, err)
+	changed, err = a.Heartbeat(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"a", "b"}, a.Members())
+	split := owners([]*Membership{a, b}, ids)
+	for _, id := range ids {
+		assert.Len(t, split[id], 1, "match %s must have exactly one owner", id)
+	}
+
+	// b stops heartbeating and a takes its matches back once it expires
+	mr.SetTime(now.Add(ttl / 2))
+	changed, err = a.Heartbeat(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	mr.SetTime(now.Add(ttl + time.Second))
+	changed, err = a.Heartbeat(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"a"}, a.Members())
+	for _, id := range ids {
+		assert.True(t, a.Owns(id))
+	}
+}
+
+func TestMembershipLeave(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	a := NewMembership(newClient(t, mr), "workers", "a", time.Minute)
+	b := NewMembership(newClient(t, mr), "workers", "b", time.Minute)
+	_, err := a.Heartbeat(ctx)
+	require.NoError(t, err)
+	_, err = b.Heartbeat(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Leave(ctx))
+	assert.False(t, b.Owns("1"))
+	_, err = a.Heartbeat(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, a.Members())
+}
+
+func TestMembershipOwnsNothingWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	a := NewMembership(newClient(t, mr), "workers", "a", 100*time.Millisecond)
+	_, err := a.Heartbeat(ctx)
+	require.NoError(t, err)
+	assert.True(t, a.Owns("1"))
+
+	mr.Close()
+	_, err = a.Heartbeat(ctx)
+	assert.Error(t, err)
+	assert.True(t, a.Owns("1"), "the last ring is kept until the heartbeat runs out")
+	assert.Eventually(t, func() bool { return !a.Owns("1") }, time.Second, 10*time.Millisecond)
+}